@@ -0,0 +1,119 @@
+// Package archiveutil provides helpers for reading the files stored in zip and tar archives.
+package archiveutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// headerSize is enough bytes to recognize any of the supported archives.
+const headerSize = 512
+
+// WalkFunc is called by Walk for each regular file in an archive
+// with its path inside the archive and a reader of its contents.
+// If it returns fs.SkipAll, Walk stops without an error.
+type WalkFunc func(name string, r io.Reader) error
+
+// Walk calls fn for each regular file in the archive, in the order they are stored.
+// The zip, tar and gzip-compressed tar formats are recognized by their magic bytes,
+// not by the file extension, so e.g. Java jars are archives too.
+// It reports false, without reading the file any further, if the file is not an archive.
+func Walk(file *os.File, fn WalkFunc) (bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() {
+		return false, nil
+	}
+	size := info.Size()
+
+	header := make([]byte, headerSize)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return true, walkZip(file, size, fn)
+	case isTar(header):
+		return true, walkTar(io.NewSectionReader(file, 0, size), fn)
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(io.NewSectionReader(file, 0, size))
+		if err != nil {
+			return false, nil
+		}
+		br := bufio.NewReader(gz)
+		header, err := br.Peek(headerSize)
+		if err != nil && err != io.EOF {
+			return false, nil
+		}
+		if !isTar(header) {
+			return false, nil
+		}
+		return true, walkTar(br, fn)
+	}
+	return false, nil
+}
+
+// isTar reports whether header starts with a tar header in the ustar or GNU format.
+func isTar(header []byte) bool {
+	return len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar"))
+}
+
+func walkZip(r io.ReaderAt, size int64, fn WalkFunc) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(f.Name, rc)
+		rc.Close()
+		if errors.Is(err, fs.SkipAll) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(r io.Reader, fn WalkFunc) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = fn(h.Name, tr)
+		if errors.Is(err, fs.SkipAll) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
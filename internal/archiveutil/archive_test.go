@@ -0,0 +1,163 @@
+package archiveutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type member struct {
+	name, data string
+}
+
+func TestWalk(t *testing.T) {
+	members := []member{
+		{name: "a.txt", data: "one\n"},
+		{name: "dir/b.txt", data: "two\n"},
+	}
+
+	tests := []struct {
+		data []byte
+		ok   bool
+		exp  []member
+	}{
+		{
+			data: zipData(t, members),
+			ok:   true,
+			exp:  members,
+		},
+		{
+			data: tarData(t, members),
+			ok:   true,
+			exp:  members,
+		},
+		{
+			data: gzipData(t, tarData(t, members)),
+			ok:   true,
+			exp:  members,
+		},
+		{
+			data: gzipData(t, []byte("one\n")),
+			ok:   false,
+		},
+		{
+			data: []byte("one\n"),
+			ok:   false,
+		},
+		{
+			data: []byte{},
+			ok:   false,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			file := createFile(t, test.data)
+
+			var act []member
+			ok, err := Walk(file, func(name string, r io.Reader) error {
+				data, err := io.ReadAll(r)
+				act = append(act, member{name: name, data: string(data)})
+				return err
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ok != test.ok {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", ok, test.ok)
+			}
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestWalkSkipAll(t *testing.T) {
+	members := []member{
+		{name: "a.txt", data: "one\n"},
+		{name: "b.txt", data: "two\n"},
+	}
+	file := createFile(t, tarData(t, members))
+
+	var act []string
+	ok, err := Walk(file, func(name string, r io.Reader) error {
+		act = append(act, name)
+		return fs.SkipAll
+	})
+	if err != nil || !ok {
+		t.Fatalf("Unexpected result: %v, %v", ok, err)
+	}
+	if exp := []string{"a.txt"}; !slices.Equal(act, exp) {
+		t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, exp)
+	}
+}
+
+func zipData(t *testing.T, members []member) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	if _, err := w.Create("dir/"); err != nil {
+		t.Fatalf("Failed to write the archive: %v", err)
+	}
+	for _, m := range members {
+		f, err := w.Create(m.name)
+		if err != nil {
+			t.Fatalf("Failed to write the archive: %v", err)
+		}
+		f.Write([]byte(m.data))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to write the archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func tarData(t *testing.T, members []member) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	if err := w.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatalf("Failed to write the archive: %v", err)
+	}
+	for _, m := range members {
+		h := &tar.Header{Name: m.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(m.data))}
+		if err := w.WriteHeader(h); err != nil {
+			t.Fatalf("Failed to write the archive: %v", err)
+		}
+		w.Write([]byte(m.data))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to write the archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func createFile(t *testing.T, data []byte) *os.File {
+	path := filepath.Join(t.TempDir(), "archive")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file
+}
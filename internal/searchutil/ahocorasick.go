@@ -0,0 +1,330 @@
+package searchutil
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ahoCorasick is an automaton that finds occurrences of many fixed strings
+// in a single pass over the text.
+//
+// The automaton advances by units: bytes, or runes if it folds case.
+// When folding, the patterns and the text are compared by their case-folded
+// runes, while the reported positions refer to the original text.
+type ahoCorasick struct {
+	nodes []acNode
+	// lens holds the length of each pattern in units.
+	lens []int
+	// maxLen is the length of the longest pattern in units.
+	maxLen int
+	// hasEmpty is set if one of the patterns is empty and so matches any text.
+	hasEmpty bool
+	fold     bool
+}
+
+type acNode struct {
+	// edges are sorted by byte.
+	edges []acEdge
+	// fail is the node of the longest proper suffix of this node that is in the trie.
+	fail int32
+	// dict is the nearest node on the fail chain that ends a pattern, or -1.
+	dict int32
+	// out holds the indices of the patterns ending at this node.
+	out []int32
+	// depth is the length in units of the string spelled by this node.
+	depth int32
+}
+
+type acEdge struct {
+	b    byte
+	node int32
+}
+
+// acMatch is an occurrence of a pattern in the text.
+type acMatch struct {
+	start, end int
+	pattern    int
+}
+
+// newAhoCorasick builds the automaton for the patterns.
+// With fold the patterns are matched case-insensitively.
+func newAhoCorasick(patterns []string, fold bool) *ahoCorasick {
+	ac := &ahoCorasick{
+		nodes: []acNode{{dict: -1}},
+		lens:  make([]int, len(patterns)),
+		fold:  fold,
+	}
+	for i, pattern := range patterns {
+		if fold {
+			pattern = foldString(pattern)
+		}
+		if pattern == "" {
+			ac.hasEmpty = true
+			continue
+		}
+		node := int32(0)
+		for j := 0; j < len(pattern); j++ {
+			next, ok := ac.child(node, pattern[j])
+			if !ok {
+				depth := ac.nodes[node].depth
+				if !fold || utf8.RuneStart(pattern[j]) {
+					depth++
+				}
+				next = int32(len(ac.nodes))
+				ac.nodes = append(ac.nodes, acNode{dict: -1, depth: depth})
+				ac.addEdge(node, pattern[j], next)
+			}
+			node = next
+		}
+		ac.nodes[node].out = append(ac.nodes[node].out, int32(i))
+		ac.lens[i] = int(ac.nodes[node].depth)
+		ac.maxLen = max(ac.maxLen, ac.lens[i])
+	}
+
+	// The fail links are set in breadth-first order,
+	// so that the links of shallower nodes are ready when needed.
+	queue := []int32{}
+	for _, e := range ac.nodes[0].edges {
+		queue = append(queue, e.node)
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, e := range ac.nodes[node].edges {
+			fail := ac.nodes[node].fail
+			next, ok := ac.child(fail, e.b)
+			for !ok && fail != 0 {
+				fail = ac.nodes[fail].fail
+				next, ok = ac.child(fail, e.b)
+			}
+			if !ok {
+				next = 0
+			}
+			ac.nodes[e.node].fail = next
+			if len(ac.nodes[next].out) > 0 {
+				ac.nodes[e.node].dict = next
+			} else {
+				ac.nodes[e.node].dict = ac.nodes[next].dict
+			}
+			queue = append(queue, e.node)
+		}
+	}
+
+	return ac
+}
+
+func (ac *ahoCorasick) child(node int32, b byte) (int32, bool) {
+	edges := ac.nodes[node].edges
+	i := sort.Search(len(edges), func(i int) bool {
+		return edges[i].b >= b
+	})
+	if i < len(edges) && edges[i].b == b {
+		return edges[i].node, true
+	}
+	return 0, false
+}
+
+func (ac *ahoCorasick) addEdge(node int32, b byte, next int32) {
+	edges := ac.nodes[node].edges
+	i := sort.Search(len(edges), func(i int) bool {
+		return edges[i].b >= b
+	})
+	ac.nodes[node].edges = slices.Insert(edges, i, acEdge{b: b, node: next})
+}
+
+// step returns the node reached from node by the byte b.
+func (ac *ahoCorasick) step(node int32, b byte) int32 {
+	for {
+		if next, ok := ac.child(node, b); ok {
+			return next
+		}
+		if node == 0 {
+			return 0
+		}
+		node = ac.nodes[node].fail
+	}
+}
+
+// next advances the automaton by the unit of the text at i.
+// It returns the reached node and the position of the next unit.
+func (ac *ahoCorasick) next(node int32, text string, i int) (int32, int) {
+	if !ac.fold {
+		return ac.step(node, text[i]), i + 1
+	}
+	r, size := utf8.DecodeRuneInString(text[i:])
+	if r < utf8.RuneSelf {
+		return ac.step(node, byte(foldRune(r))), i + 1
+	}
+	if r == utf8.RuneError && size == 1 {
+		return ac.step(node, text[i]), i + 1
+	}
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], foldRune(r))
+	for _, b := range buf[:n] {
+		node = ac.step(node, b)
+	}
+	return node, i + size
+}
+
+// acAccept reports whether an occurrence at text[start:end] counts as a match.
+// A nil acAccept accepts all occurrences.
+type acAccept func(text string, start, end int) bool
+
+// match reports whether any of the patterns occurs in the text.
+func (ac *ahoCorasick) match(text string, accept acAccept) bool {
+	if ac.hasEmpty && ac.matchEmpty(text, accept) {
+		return true
+	}
+	if accept == nil {
+		node := int32(0)
+		for i := 0; i < len(text); {
+			node, i = ac.next(node, text, i)
+			if len(ac.nodes[node].out) > 0 || ac.nodes[node].dict >= 0 {
+				return true
+			}
+		}
+		return false
+	}
+	return len(ac.findAll(text, accept)) > 0
+}
+
+// index returns the end of the first occurrence of any of the patterns in the text,
+// or -1 if there is none. The first occurrence is the one that ends first.
+func (ac *ahoCorasick) index(text string) int {
+	if ac.hasEmpty {
+		return 0
+	}
+	node := int32(0)
+	for i := 0; i < len(text); {
+		node, i = ac.next(node, text, i)
+		if len(ac.nodes[node].out) > 0 || ac.nodes[node].dict >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchEmpty reports whether an empty pattern is accepted at any position of the text.
+func (ac *ahoCorasick) matchEmpty(text string, accept acAccept) bool {
+	if accept == nil {
+		return true
+	}
+	for i := 0; i <= len(text); i++ {
+		if (i == len(text) || utf8.RuneStart(text[i])) && accept(text, i, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// findAll returns the leftmost-longest non-overlapping accepted occurrences of the patterns.
+// Empty patterns are never reported.
+func (ac *ahoCorasick) findAll(text string, accept acAccept) []acMatch {
+	var matches []acMatch
+	best := acMatch{start: -1}
+	node := int32(0)
+	// starts holds the positions of the last units, so that the start
+	// of an occurrence can be found from its length in units.
+	starts := make([]int, ac.maxLen+1)
+	unit := 0
+	for i := 0; ; {
+		if i == len(text) {
+			if best.start < 0 {
+				return matches
+			}
+			// The text ends, so best is final, but more occurrences may follow it.
+			matches = append(matches, best)
+			i = best.end
+			node = 0
+			best = acMatch{start: -1}
+			continue
+		}
+		starts[unit%len(starts)] = i
+		unit++
+		node, i = ac.next(node, text, i)
+		for n := node; n > 0; n = ac.nodes[n].dict {
+			for _, pattern := range ac.nodes[n].out {
+				start := starts[(unit-ac.lens[pattern])%len(starts)]
+				if accept != nil && !accept(text, start, i) {
+					continue
+				}
+				if best.start < 0 || start < best.start || start == best.start && i > best.end {
+					best = acMatch{start: start, end: i, pattern: int(pattern)}
+				}
+			}
+		}
+		if best.start < 0 {
+			continue
+		}
+		// No later occurrence can start at or before the best one
+		// once the current node is too shallow to reach back to it.
+		earliest := i
+		if depth := int(ac.nodes[node].depth); depth > 0 {
+			earliest = starts[(unit-depth)%len(starts)]
+		}
+		if earliest > best.start {
+			matches = append(matches, best)
+			i = best.end
+			node = 0
+			best = acMatch{start: -1}
+		}
+	}
+}
+
+// patternsIn returns the sorted indices of the patterns that occur in the text.
+func (ac *ahoCorasick) patternsIn(text string, accept acAccept) []int {
+	seen := make([]bool, len(ac.lens))
+	if ac.hasEmpty && ac.matchEmpty(text, accept) {
+		for i, l := range ac.lens {
+			seen[i] = l == 0
+		}
+	}
+	node := int32(0)
+	starts := make([]int, ac.maxLen+1)
+	unit := 0
+	for i := 0; i < len(text); {
+		starts[unit%len(starts)] = i
+		unit++
+		node, i = ac.next(node, text, i)
+		for n := node; n > 0; n = ac.nodes[n].dict {
+			for _, pattern := range ac.nodes[n].out {
+				start := starts[(unit-ac.lens[pattern])%len(starts)]
+				if accept == nil || accept(text, start, i) {
+					seen[pattern] = true
+				}
+			}
+		}
+	}
+
+	var indices []int
+	for i, ok := range seen {
+		if ok {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// foldRune returns the smallest rune that is equivalent to r
+// under Unicode simple case folding, e.g. 'K' for 'k' and the Kelvin sign.
+func foldRune(r rune) rune {
+	if r < utf8.RuneSelf {
+		if 'a' <= r && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		return r
+	}
+	smallest := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		smallest = min(smallest, f)
+	}
+	return smallest
+}
+
+// foldString replaces each rune of s with its folded form.
+func foldString(s string) string {
+	return strings.Map(foldRune, s)
+}
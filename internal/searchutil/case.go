@@ -1,11 +0,0 @@
-package searchutil
-
-import "strings"
-
-func skipCase(text string) string {
-	return text
-}
-
-func toLowerCase(text string) string {
-	return strings.ToLower(text)
-}
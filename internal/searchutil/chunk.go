@@ -0,0 +1,191 @@
+package searchutil
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// chunkSize is the size of the chunks of the input matched by the goroutines
+// of a parallel search. A chunk is extended to the end of its last line.
+const chunkSize = 1 << 20
+
+// chunk is a part of the input made of whole lines.
+type chunk struct {
+	data []byte
+	// matches holds the result of the matcher for each line of the chunk.
+	matches []bool
+	done    chan struct{}
+}
+
+// searchChunks searches the input in chunks: n goroutines match the lines of
+// the chunks, and the lines are then passed in order to the usual search
+// functions with the precomputed results, so that line numbers, context and
+// the other options work as in a sequential search.
+func (s *Search) searchChunks(r io.Reader, n int) error {
+	match := s.match
+	s.match = (*Search).matchPrecomputed
+	defer func() { s.match = match }()
+
+	// On return, stop makes the goroutines exit, and they are waited for.
+	// The reader is waited for too, as the caller may go on reading r,
+	// e.g. the next member of an archive.
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	stop := make(chan struct{})
+	defer close(stop)
+
+	ordered := make(chan *chunk, 2*n)
+	work := make(chan *chunk, 2*n)
+	var readErr error
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		defer close(ordered)
+		defer close(work)
+		readErr = s.splitChunks(r, func(c *chunk) bool {
+			select {
+			case ordered <- c:
+			case <-stop:
+				return false
+			}
+			select {
+			case work <- c:
+				return true
+			case <-stop:
+				return false
+			}
+		})
+	}()
+
+	for range n {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case c, ok := <-work:
+					if !ok {
+						return
+					}
+					s.matchChunk(c, match)
+					close(c.done)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	i := 1
+	for c := range ordered {
+		<-c.done
+		data := c.data
+		for k := 0; len(data) > 0; k++ {
+			if s.stopped {
+				return nil
+			}
+			var line []byte
+			line, data = nextLine(data)
+			text, long := clipLine(line, s.maxLineLength)
+			if !long || s.longLines != SkipLongLines {
+				s.precomputed = c.matches[k]
+				s.searchLine(bytesView(text), i)
+			}
+			i++
+		}
+	}
+	// The reader has finished once ordered is closed.
+	return readErr
+}
+
+// splitChunks reads the input and passes it to send in chunks of whole lines,
+// until send returns false or the input ends. As lineReader does, it only keeps
+// the start of a line longer than the limit set by SetMaxLineLength,
+// so that the limit also bounds the memory of a parallel search.
+func (s *Search) splitChunks(r io.Reader, send func(c *chunk) bool) error {
+	var rest, unsent []byte
+	// dropping is set while the end of a line longer than the limit is read.
+	dropping := false
+	for {
+		// The buffer of a chunk that was not sent is reused, with rest at its start.
+		var data []byte
+		if size := max(chunkSize, 2*len(rest)); cap(unsent) >= size {
+			data = unsent[:len(rest)]
+		} else {
+			data = make([]byte, len(rest), size)
+			copy(data, rest)
+		}
+		unsent = nil
+		n, err := io.ReadFull(r, data[len(rest):cap(data)])
+		data = data[:len(rest)+n]
+		if dropping {
+			read := data[len(rest):]
+			i := bytes.IndexByte(read, '\n')
+			if i < 0 {
+				i = len(read)
+			} else {
+				dropping = false
+			}
+			data = append(data[:len(rest)], read[i:]...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if len(data) > 0 {
+				send(&chunk{data: data, done: make(chan struct{})})
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// A line that does not fit into the chunk is carried over to the next one, which is larger.
+		rest, unsent = data, data
+		if end := bytes.LastIndexByte(data, '\n'); end >= 0 {
+			rest, unsent = data[end+1:], nil
+			if !send(&chunk{data: data[:end+1], done: make(chan struct{})}) {
+				return nil
+			}
+		}
+		// Room for "\r\n" is kept, so that the line is still found to be long.
+		if s.maxLineLength > 0 && len(rest) > s.maxLineLength+2 {
+			rest, dropping = rest[:s.maxLineLength+2], true
+		}
+	}
+}
+
+// matchChunk matches each line of the chunk with the matcher.
+func (s *Search) matchChunk(c *chunk, match func(s *Search, text string) bool) {
+	data := c.data
+	for len(data) > 0 {
+		var line []byte
+		line, data = nextLine(data)
+		text, _ := clipLine(line, s.maxLineLength)
+		c.matches = append(c.matches, match(s, bytesView(text)))
+	}
+}
+
+// matchPrecomputed returns the result of the matcher for the current line,
+// computed by matchChunk.
+func (s *Search) matchPrecomputed(_ string) bool {
+	return s.precomputed
+}
+
+// nextLine splits data into its first line, without the "\n", and the rest.
+func nextLine(data []byte) (line, rest []byte) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return data, nil
+	}
+	return data[:i], data[i+1:]
+}
+
+// clipLine removes the trailing "\r" of a line and truncates it to max bytes,
+// as lineReader does.
+func clipLine(line []byte, max int) (text []byte, long bool) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if max > 0 && len(line) > max {
+		return line[:max], true
+	}
+	return line, false
+}
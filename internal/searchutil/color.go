@@ -0,0 +1,80 @@
+package searchutil
+
+import "strings"
+
+// colors holds the SGR sequences used to highlight the output,
+// named after the GREP_COLORS capabilities of GNU grep.
+type colors struct {
+	selectedMatch string // ms
+	contextMatch  string // mc
+	selectedLine  string // sl
+	contextLine   string // cx
+	fileName      string // fn
+	lineNumber    string // ln
+	separator     string // se
+}
+
+// parseColors returns the default colors of GNU grep
+// overridden by the capabilities in a GREP_COLORS-style spec,
+// e.g. "ms=01;32:fn=34:se=". Unknown capabilities are ignored.
+func parseColors(spec string) *colors {
+	c := &colors{
+		selectedMatch: "01;31",
+		contextMatch:  "01;31",
+		fileName:      "35",
+		lineNumber:    "32",
+		separator:     "36",
+	}
+	for _, capability := range strings.Split(spec, ":") {
+		name, value, _ := strings.Cut(capability, "=")
+		switch name {
+		case "mt":
+			c.selectedMatch = value
+			c.contextMatch = value
+		case "ms":
+			c.selectedMatch = value
+		case "mc":
+			c.contextMatch = value
+		case "sl":
+			c.selectedLine = value
+		case "cx":
+			c.contextLine = value
+		case "fn":
+			c.fileName = value
+		case "ln":
+			c.lineNumber = value
+		case "se":
+			c.separator = value
+		}
+	}
+	return c
+}
+
+// paint wraps text in the SGR sequence, unless one of them is empty.
+func paint(sgr, text string) string {
+	if sgr == "" || text == "" {
+		return text
+	}
+	return "\x1b[" + sgr + "m\x1b[K" + text + "\x1b[m\x1b[K"
+}
+
+// highlight colors the matches in a selected or context line.
+func (s *Search) highlight(text string, sep byte) string {
+	matchColor, lineColor := s.colors.selectedMatch, s.colors.selectedLine
+	if sep == contextSep {
+		matchColor, lineColor = s.colors.contextMatch, s.colors.contextLine
+	}
+	if s.onlyMatching {
+		return paint(matchColor, text)
+	}
+
+	var b strings.Builder
+	end := 0
+	for _, span := range s.findAll(s, text) {
+		b.WriteString(paint(lineColor, text[end:span[0]]))
+		b.WriteString(paint(matchColor, text[span[0]:span[1]]))
+		end = span[1]
+	}
+	b.WriteString(paint(lineColor, text[end:]))
+	return b.String()
+}
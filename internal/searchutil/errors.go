@@ -0,0 +1,35 @@
+package searchutil
+
+import "fmt"
+
+// PatternError reports that a search pattern could not be compiled.
+type PatternError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("regular expression compilation error: %v", e.Err)
+}
+
+func (e *PatternError) Unwrap() error {
+	return e.Err
+}
+
+// IOError reports that the input could not be read or the output could not be written.
+type IOError struct {
+	Op   string
+	Name string
+	Err  error
+}
+
+func (e *IOError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%v error: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%v error: %v: %v", e.Op, e.Name, e.Err)
+}
+
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
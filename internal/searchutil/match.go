@@ -1,13 +1,144 @@
 package searchutil
 
-import "strings"
+import (
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode"
+)
 
 func (s *Search) matchRegexp(text string) bool {
-	text = s.toCase(text)
+	if s.prefilter != nil && !s.prefilter.mayMatch(text) {
+		return false
+	}
 	return s.re.MatchString(text)
 }
 
 func (s *Search) matchFixString(text string) bool {
-	text = s.toCase(text)
-	return strings.Contains(text, s.searchWord)
+	for _, pattern := range s.patterns {
+		if strings.Contains(text, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Search) findAllRegexp(text string) [][]int {
+	if s.prefilter != nil && !s.prefilter.mayMatch(text) {
+		return nil
+	}
+	spans := s.re.FindAllStringIndex(text, -1)
+	return slices.DeleteFunc(spans, func(span []int) bool {
+		return span[0] == span[1]
+	})
+}
+
+// findAllFixString returns the leftmost-longest non-overlapping occurrences of the patterns.
+func (s *Search) findAllFixString(text string) [][]int {
+	var spans [][]int
+	for start := 0; ; {
+		begin, end := -1, -1
+		for _, pattern := range s.patterns {
+			if pattern == "" {
+				continue
+			}
+			i := strings.Index(text[start:], pattern)
+			if i < 0 {
+				continue
+			}
+			i += start
+			if begin < 0 || i < begin || i == begin && i+len(pattern) > end {
+				begin, end = i, i+len(pattern)
+			}
+		}
+		if begin < 0 {
+			return spans
+		}
+		spans = append(spans, []int{begin, end})
+		start = end
+	}
+}
+
+func (s *Search) matchAhoCorasick(text string) bool {
+	return s.ac.match(text, s.accept)
+}
+
+func (s *Search) findAllAhoCorasick(text string) [][]int {
+	matches := s.ac.findAll(text, s.accept)
+	spans := make([][]int, len(matches))
+	for i, m := range matches {
+		spans[i] = []int{m.start, m.end}
+	}
+	return spans
+}
+
+// compileRegexp compiles the patterns into a single regular expression
+// that matches if any of them matches. With ignoreCase the patterns
+// are matched with Unicode case folding, as if they had the (?i) flag.
+func compileRegexp(patterns []string, ignoreCase bool) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return regexp.MustCompile(`[^\x00-\x{10FFFF}]`), nil
+	}
+
+	alternatives := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		re, err := compilePattern(pattern, ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		if len(patterns) == 1 {
+			return re, nil
+		}
+		alternatives[i] = re.String()
+	}
+	combined := "(?:" + strings.Join(alternatives, ")|(?:") + ")"
+	re, err := regexp.Compile(combined)
+	if err != nil {
+		return nil, &PatternError{Pattern: combined, Err: err}
+	}
+	return re, nil
+}
+
+// compilePattern compiles a single pattern, reporting errors against its original text.
+func compilePattern(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, &PatternError{Pattern: pattern, Err: err}
+	}
+	if ignoreCase {
+		pattern = "(?i:" + pattern + ")"
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &PatternError{Pattern: pattern, Err: err}
+	}
+	return re, nil
+}
+
+// hasUpper reports whether any of the patterns contains an uppercase letter.
+// Regular expressions are parsed, so that only their literal characters count.
+func hasUpper(patterns []string, fixString bool) (bool, error) {
+	for _, pattern := range patterns {
+		if fixString {
+			if strings.IndexFunc(pattern, unicode.IsUpper) >= 0 {
+				return true, nil
+			}
+			continue
+		}
+		re, err := syntax.Parse(pattern, syntax.Perl)
+		if err != nil {
+			return false, &PatternError{Pattern: pattern, Err: err}
+		}
+		if hasUpperLiteral(re) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func hasUpperLiteral(re *syntax.Regexp) bool {
+	if re.Op == syntax.OpLiteral && slices.ContainsFunc(re.Rune, unicode.IsUpper) {
+		return true
+	}
+	return slices.ContainsFunc(re.Sub, hasUpperLiteral)
 }
@@ -1,76 +1,134 @@
 package searchutil
 
-import "fmt"
+// The search functions take a line that is only valid during the call,
+// as it shares the memory of the read buffer, and the number of the line.
 
-func (s *Search) searchDefault(text string, i int) {
-	if s.match(text) {
-		s.output(text, fmt.Sprint(i))
+func (s *Search) searchDefault(text string, n int) {
+	if s.match(s, text) {
+		s.selectLine(text, n)
 	}
 }
 
-func (s *Search) searchDefaultInvert(text string, i int) {
-	if !s.match(text) {
-		s.output(text, fmt.Sprint(i))
+func (s *Search) searchDefaultInvert(text string, n int) {
+	if !s.match(s, text) {
+		s.selectLine(text, n)
 	}
 }
 
-func (s *Search) searchInFileWithContext(text string, strNumber int) {
-	if s.match(text) {
+func (s *Search) searchInFileWithContext(text string, n int) {
+	if s.match(s, text) {
 		if s.isPreCtx {
-			for i := len(s.preCtxTextBuf) - 1; i >= 0; i-- {
-				if s.preCtxTextBuf[i] != "" {
-					s.output(s.preCtxTextBuf[i], s.preCtxStrNumBuf[i])
+			for i := len(s.preCtx) - 1; i >= 0; i-- {
+				if s.preCtx[i].ok {
+					s.contextLine(bytesView(s.preCtx[i].text), s.preCtx[i].n)
 				}
 			}
 		}
 		s.isPreCtx = false
 
-		s.output(text, fmt.Sprint(strNumber))
+		s.selectLine(text, n)
 
 		s.afterCtxCount = s.afterContext
 	} else {
 		s.isPreCtx = true
-		for i := len(s.preCtxTextBuf) - 1; i > 0; i-- {
-			s.preCtxTextBuf[i] = s.preCtxTextBuf[i-1]
-			s.preCtxStrNumBuf[i] = s.preCtxStrNumBuf[i-1]
-		}
-		if len(s.preCtxTextBuf) > 0 {
-			s.preCtxTextBuf[0] = text
-			s.preCtxStrNumBuf[0] = fmt.Sprint(strNumber)
-		}
+		s.pushPreCtx(text, n)
 
 		if s.afterCtxCount > 0 {
-			s.output(text, fmt.Sprint(strNumber))
+			s.contextLine(text, n)
 			s.afterCtxCount--
 			s.isPreCtx = false
 		}
 	}
 }
 
-func (s *Search) searchInFileWithContextInvert(text string, strNumber int) {
-	if !s.match(text) {
+func (s *Search) searchInFileWithContextInvert(text string, n int) {
+	if !s.match(s, text) {
 		if s.afterCtxCount <= 0 {
-			if len(s.preCtxTextBuf) > 0 {
-				lastIndex := len(s.preCtxTextBuf) - 1
-				if s.preCtxTextBuf[lastIndex] != "" {
-					s.output(s.preCtxTextBuf[lastIndex], s.preCtxStrNumBuf[lastIndex])
+			if len(s.preCtx) > 0 {
+				last := s.preCtx[len(s.preCtx)-1]
+				if last.ok {
+					s.selectLine(bytesView(last.text), last.n)
 				}
-				for i := len(s.preCtxTextBuf) - 1; i > 0; i-- {
-					s.preCtxTextBuf[i] = s.preCtxTextBuf[i-1]
-					s.preCtxStrNumBuf[i] = s.preCtxStrNumBuf[i-1]
-				}
-				s.preCtxTextBuf[0] = text
-				s.preCtxStrNumBuf[0] = fmt.Sprint(strNumber)
+				s.pushPreCtx(text, n)
 			} else {
-				s.output(text, fmt.Sprint(strNumber))
+				s.selectLine(text, n)
 			}
 		}
 		s.afterCtxCount--
 	} else {
-		for i := len(s.preCtxTextBuf) - 1; i >= 0; i-- {
-			s.preCtxTextBuf[i] = ""
-			s.preCtxStrNumBuf[i] = ""
-		}
+		s.clearPreCtx()
 		s.afterCtxCount = s.afterContext
 	}
 }
+
+// ctxLine is a line kept for the context before a selected line.
+type ctxLine struct {
+	text []byte
+	n    int
+	ok   bool
+}
+
+// pushPreCtx keeps the line as the latest line of the context before a selected line,
+// dropping the earliest one. The memory of the dropped line is reused.
+func (s *Search) pushPreCtx(text string, n int) {
+	if len(s.preCtx) == 0 {
+		return
+	}
+	last := s.preCtx[len(s.preCtx)-1]
+	copy(s.preCtx[1:], s.preCtx[:len(s.preCtx)-1])
+	s.preCtx[0] = ctxLine{text: append(last.text[:0], text...), n: n, ok: true}
+}
+
+// clearPreCtx drops the lines kept for the context, keeping their memory.
+func (s *Search) clearPreCtx() {
+	for i := range s.preCtx {
+		s.preCtx[i].ok = false
+	}
+}
+
+// selectLine outputs a line selected by the search.
+func (s *Search) selectLine(text string, n int) {
+	if s.maxReached() {
+		return
+	}
+	s.selected++
+	if s.onlyMatching {
+		for _, span := range s.findAll(s, text) {
+			s.output(s, text[span[0]:span[1]], n, matchSep)
+		}
+	} else {
+		s.output(s, text, n, matchSep)
+	}
+	if s.stopOnMatch {
+		s.stopped = true
+	}
+	if s.maxReached() && (s.afterContext == 0 || s.isInvert) {
+		s.stopped = true
+	}
+}
+
+// contextLine outputs a line of context around a selected line.
+func (s *Search) contextLine(text string, n int) {
+	if !s.onlyMatching {
+		s.output(s, text, n, contextSep)
+	}
+}
+
+// maxReached reports whether the search has selected as many lines as allowed.
+func (s *Search) maxReached() bool {
+	return s.isMaxCount && s.selected >= s.maxCount
+}
+
+// searchTrailingContext outputs the context after the last allowed selected line.
+// As in GNU grep, the lines that would be selected are output as context too.
+func (s *Search) searchTrailingContext(text string, n int) {
+	if s.afterCtxCount <= 0 {
+		s.stopped = true
+		return
+	}
+	s.contextLine(text, n)
+	s.afterCtxCount--
+	if s.afterCtxCount <= 0 {
+		s.stopped = true
+	}
+}
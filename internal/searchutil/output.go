@@ -1,23 +1,113 @@
 package searchutil
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
 
-func (s *Search) defaultOutput(args ...string) {
-	if s.enableStringNumber {
-		fmt.Printf("%v: %v", args[1], args[0])
-	} else {
-		fmt.Println(args[0])
+// Separators placed after the file name and the line number,
+// as in GNU grep: selected lines use ':' and context lines use '-'.
+const (
+	matchSep   = ':'
+	contextSep = '-'
+)
+
+func (s *Search) defaultOutput(text string, n int, sep byte) {
+	s.write(s.format(text, n, sep) + "\n")
+}
+
+func (s *Search) fileNameOutput(_ string, _ int, sep byte) {
+	if sep == matchSep {
+		s.writeFileName()
 	}
 }
 
-func (s *Search) toArrayOutput(args ...string) {
-	if s.enableStringNumber {
-		s.outputArr = append(s.outputArr, fmt.Sprintf("%v: %v", args[1], args[0]))
+// writeFileName writes the file name followed by a newline, or a zero byte with -Z.
+func (s *Search) writeFileName() {
+	name := s.name()
+	if s.colors != nil {
+		name = paint(s.colors.fileName, name)
+	}
+	if s.nullAfterName {
+		s.write(name + "\x00")
 	} else {
-		s.outputArr = append(s.outputArr, args[0])
+		s.write(name + "\n")
+	}
+}
+
+// name returns the name of the input for the output that names the file itself.
+func (s *Search) name() string {
+	switch {
+	case s.fileName != "":
+		return s.fileName
+	case s.inputName != "":
+		return s.inputName
+	}
+	return "(standard input)"
+}
+
+// write writes to the writer of the search, which stops at the first error.
+func (s *Search) write(text string) {
+	if s.writeErr != nil {
+		return
+	}
+	_, s.writeErr = io.WriteString(s.writer, text)
+	if s.writeErr != nil {
+		s.stopped = true
 	}
 }
 
-func (s *Search) countOutput(_ ...string) {
+func (s *Search) toArrayOutput(text string, n int, sep byte) {
+	// The line shares the memory of the read buffer, so it is copied to be kept.
+	s.outputArr = append(s.outputArr, strings.Clone(s.format(text, n, sep)))
+}
+
+func (s *Search) countOutput(_ string, _ int, _ byte) {
 	s.count++
 }
+
+func (s *Search) format(text string, n int, sep byte) string {
+	fileName, sepStr := s.fileName, string(sep)
+	strNumber := ""
+	if s.enableStringNumber {
+		strNumber = strconv.Itoa(n)
+	}
+	if s.colors != nil {
+		text = s.highlight(text, sep)
+		fileName = paint(s.colors.fileName, fileName)
+		strNumber = paint(s.colors.lineNumber, strNumber)
+		sepStr = paint(s.colors.separator, sepStr)
+	}
+
+	prefix := ""
+	if s.fileName != "" && s.nullAfterName {
+		prefix = fileName + "\x00"
+	} else if s.fileName != "" {
+		prefix = fileName + sepStr
+	}
+	if s.enableStringNumber {
+		return fmt.Sprintf("%v%v%v %v", prefix, strNumber, sepStr, text)
+	}
+	return prefix + text
+}
+
+// binaryOutput replaces the output for binary inputs: the first selected line
+// stops the search, and binaryMatchesOutput reports it instead of the line.
+func (s *Search) binaryOutput(_ string, _ int, sep byte) {
+	if sep == matchSep {
+		s.stopped = true
+	}
+}
+
+func (s *Search) binaryMatchesOutput() {
+	message := fmt.Sprintf("Binary file %v matches", s.name())
+	if s.outputArr != nil {
+		s.outputArr = append(s.outputArr, message)
+		return
+	}
+	s.write(message + "\n")
+}
+
+func (s *Search) quietOutput(_ string, _ int, _ byte) {}
@@ -0,0 +1,153 @@
+package searchutil
+
+import (
+	"bytes"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// frequentBytes lists the bytes that are common in text, from the most common one.
+// The other bytes, such as uppercase letters and punctuation, are taken as rare.
+const frequentBytes = " 0123456789etaoinsrhldcumfpgwybvkxjqz"
+
+// maxPrefilterLiterals bounds the number of literals of a prefilter,
+// as alternations of many short literals filter out little.
+const maxPrefilterLiterals = 256
+
+// prefilter rejects the lines that cannot match a regular expression,
+// because every match of it contains one of its literals. Searching for
+// literals is much faster than running the regexp, and on most inputs
+// few lines contain them.
+type prefilter struct {
+	// literal is set if there is a single literal matched with case.
+	literal string
+	// rare is the offset of the rarest byte of literal, which is searched for first.
+	rare int
+	// ac finds several literals, or literals matched without case.
+	ac *ahoCorasick
+}
+
+// newPrefilter returns a prefilter for the regular expression,
+// or nil if no literal is required by its matches.
+func newPrefilter(expr string) *prefilter {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	literals, fold, ok := requiredLiterals(re.Simplify())
+	if !ok {
+		return nil
+	}
+	if len(literals) == 1 && !fold {
+		return &prefilter{literal: literals[0], rare: rarestByte(literals[0])}
+	}
+	return &prefilter{ac: newAhoCorasick(literals, fold)}
+}
+
+// mayMatch reports whether the text contains one of the literals.
+func (p *prefilter) mayMatch(text string) bool {
+	if p.ac != nil {
+		return p.ac.match(text, nil)
+	}
+	return strings.Contains(text, p.literal)
+}
+
+// index returns the end of the first occurrence of the literals in data, or -1.
+func (p *prefilter) index(data []byte) int {
+	if p.ac != nil {
+		return p.ac.index(bytesView(data))
+	}
+	for pos := 0; ; {
+		i := bytes.IndexByte(data[pos:], p.literal[p.rare])
+		if i < 0 {
+			return -1
+		}
+		start := pos + i - p.rare
+		if start >= 0 && bytes.HasPrefix(data[start:], []byte(p.literal)) {
+			return start + len(p.literal)
+		}
+		pos += i + 1
+	}
+}
+
+// rarestByte returns the offset of the byte of literal that is expected to be the rarest in text.
+// bytes.Index looks for the first byte, which is slow if it is as common as in "timeout".
+func rarestByte(literal string) int {
+	rank := func(b byte) int {
+		if i := strings.IndexByte(frequentBytes, b); i >= 0 {
+			return i
+		}
+		return len(frequentBytes)
+	}
+	rare := 0
+	for i := 1; i < len(literal); i++ {
+		if rank(literal[i]) > rank(literal[rare]) {
+			rare = i
+		}
+	}
+	return rare
+}
+
+// requiredLiterals returns literals, one of which is contained in every match of re.
+// fold is set if some of them are matched without case; they are then all matched so,
+// which can only let more lines through. It reports false if there are no such literals.
+func requiredLiterals(re *syntax.Regexp) (literals []string, fold bool, ok bool) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		// The regexp matches U+FFFD against invalid UTF-8, which a literal search would miss.
+		if len(re.Rune) == 0 || slices.Contains(re.Rune, utf8.RuneError) {
+			return nil, false, false
+		}
+		return []string{string(re.Rune)}, re.Flags&syntax.FoldCase != 0, true
+	case syntax.OpCapture:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return nil, false, false
+		}
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpConcat:
+		// Any of the parts is required, so the one that filters out the most is kept.
+		for _, sub := range re.Sub {
+			subLiterals, subFold, subOK := requiredLiterals(sub)
+			if subOK && (!ok || betterLiterals(subLiterals, literals)) {
+				literals, fold, ok = subLiterals, subFold, true
+			}
+		}
+		return literals, fold, ok
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			subLiterals, subFold, subOK := requiredLiterals(sub)
+			if !subOK {
+				return nil, false, false
+			}
+			literals = append(literals, subLiterals...)
+			fold = fold || subFold
+		}
+		if len(literals) > maxPrefilterLiterals {
+			return nil, false, false
+		}
+		return literals, fold, true
+	}
+	return nil, false, false
+}
+
+// betterLiterals reports whether a is expected to filter out more lines than b:
+// its shortest literal is longer, or as long with fewer literals.
+func betterLiterals(a, b []string) bool {
+	shortest := func(literals []string) int {
+		n := len(literals[0])
+		for _, literal := range literals[1:] {
+			n = min(n, len(literal))
+		}
+		return n
+	}
+	if shortest(a) != shortest(b) {
+		return shortest(a) > shortest(b)
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,203 @@
+package searchutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// readerSize is the size of the buffer of lineReader,
+// which bounds the first chunk of the input checked by isBinary.
+const readerSize = 32 << 10
+
+// LongLines defines what happens to the lines longer than the limit set by SetMaxLineLength.
+type LongLines int
+
+const (
+	// TruncateLongLines searches only the first bytes of a long line, up to the limit.
+	TruncateLongLines LongLines = iota
+	// SkipLongLines skips long lines entirely. They still count for line numbers.
+	SkipLongLines
+)
+
+// BinaryFiles defines how the inputs that look like binary data are searched.
+type BinaryFiles int
+
+const (
+	// BinaryFilesBinary searches binary inputs, but instead of the selected lines
+	// outputs a single "Binary file X matches" message.
+	BinaryFilesBinary BinaryFiles = iota
+	// BinaryFilesText searches binary inputs as text.
+	BinaryFilesText
+	// BinaryFilesWithoutMatch treats binary inputs as having no selected lines.
+	BinaryFilesWithoutMatch
+)
+
+// lineReader reads lines of any length, unlike bufio.Scanner,
+// which fails on lines longer than its buffer.
+type lineReader struct {
+	r *bufio.Reader
+	// max is the maximum length of a line in bytes; zero or less means no limit.
+	max int
+	buf []byte
+}
+
+func newLineReader(r io.Reader, max int) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, readerSize), max: max}
+}
+
+// reset makes the reader read from r, keeping its buffers.
+func (lr *lineReader) reset(r io.Reader, max int) {
+	lr.r.Reset(r)
+	lr.max = max
+}
+
+// isBinary reports whether the first chunk of the input looks like binary data.
+// The chunk is what the first read returns, so the input is not read any further
+// than the first line needs. It does not consume the input.
+func (lr *lineReader) isBinary() (bool, error) {
+	if _, err := lr.r.Peek(1); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	chunk, _ := lr.r.Peek(lr.r.Buffered())
+	return isBinary(chunk, false), nil
+}
+
+// isBinary reports whether data contains a NUL byte or is not valid UTF-8,
+// as GNU grep does in a UTF-8 locale. Unless atEOF, a rune cut off
+// at the end of data is not an error.
+func isBinary(data []byte, atEOF bool) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+	if !atEOF {
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					data = data[:i]
+				}
+				break
+			}
+		}
+	}
+	return !utf8.Valid(data)
+}
+
+// readLine returns the next line without the trailing "\n" or "\r\n",
+// as bufio.ScanLines does. The line is only valid until the next call,
+// as it shares the memory of the buffer. A line longer than the limit
+// is truncated to it, and long is set. At the end of the input it returns io.EOF.
+func (lr *lineReader) readLine() (line []byte, long bool, err error) {
+	chunk, err := lr.r.ReadSlice('\n')
+	if err == nil {
+		// The whole line is in the buffer of the reader, which is the common case.
+		text, long := clipLine(chunk[:len(chunk)-1], lr.max)
+		return text, long, nil
+	}
+
+	lr.buf = lr.buf[:0]
+	read, dropped := len(chunk) > 0, false
+	for {
+		// Room for "\r\n" is kept, so that the terminator is not mistaken for content.
+		if lr.max > 0 && len(lr.buf)+len(chunk) > lr.max+2 {
+			chunk = chunk[:max(lr.max+2-len(lr.buf), 0)]
+			dropped = true
+		}
+		lr.buf = append(lr.buf, chunk...)
+		if err != bufio.ErrBufferFull {
+			break
+		}
+		chunk, err = lr.r.ReadSlice('\n')
+		read = read || len(chunk) > 0
+	}
+	if err == io.EOF && !read {
+		return nil, false, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+
+	if dropped {
+		return lr.buf[:lr.max], true, nil
+	}
+	text, long := clipLine(bytes.TrimSuffix(lr.buf, []byte("\n")), lr.max)
+	return text, long, nil
+}
+
+// skipLines drops the whole lines in the buffer that end before index(buffer),
+// or all of them if index returns -1, and returns how many lines it dropped.
+// No data is read, so that searching a pipe does not wait for more input.
+func (lr *lineReader) skipLines(index func(data []byte) int) int {
+	data, _ := lr.r.Peek(lr.r.Buffered())
+	end := index(data)
+	if end < 0 {
+		end = len(data)
+	}
+	cut := bytes.LastIndexByte(data[:end], '\n')
+	if cut < 0 {
+		return 0
+	}
+	n := bytes.Count(data[:cut], []byte{'\n'}) + 1
+	lr.r.Discard(cut + 1)
+	return n
+}
+
+// bytesView returns a string that shares the memory of b, to pass a line
+// to the matchers without copying it. The string must not be kept after b changes.
+func bytesView(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// decompress returns a reader of the decompressed contents of r if r starts with
+// the magic bytes of gzip, bzip2 or zlib data, and a reader of r itself otherwise.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), nil
+	case isZlibHeader(magic) && isZlib(br):
+		return zlib.NewReader(br)
+	}
+	return br, nil
+}
+
+// isZlibHeader reports whether data starts with a zlib header of deflate data
+// with the default window size and one of the compression levels that zlib writes.
+func isZlibHeader(data []byte) bool {
+	if len(data) < 2 || data[0] != 0x78 {
+		return false
+	}
+	switch data[1] {
+	case 0x01, 0x5e, 0x9c, 0xda:
+		return true
+	}
+	return false
+}
+
+// isZlib reports whether the buffered start of the input decompresses without errors.
+// Unlike the other magic bytes, a zlib header is also a valid start of text, e.g. "x^".
+// The data cut off at the end of the buffer is not an error, unless the input ends there.
+func isZlib(br *bufio.Reader) bool {
+	data, err := br.Peek(br.Size())
+	atEOF := err == io.EOF
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err == nil {
+		_, err = io.Copy(io.Discard, zr)
+	}
+	return err == nil || err == io.ErrUnexpectedEOF && !atEOF
+}
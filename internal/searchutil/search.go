@@ -2,77 +2,168 @@
 package searchutil
 
 import (
-	"bufio"
-	"log"
+	"io"
 	"os"
 	"regexp"
-	"strings"
+	"slices"
 )
 
 // Search defines options for searching strings.
 type Search struct {
-	searchWord string
+	patterns []string
 
-	search func(text string, i int)
+	// The functions are method expressions rather than method values,
+	// so that Clone can copy them.
+	search func(s *Search, text string, i int)
 
-	match func(text string) bool
-	re    *regexp.Regexp
+	match   func(s *Search, text string) bool
+	findAll func(s *Search, text string) [][]int
+	re      *regexp.Regexp
+	// For -w, reNext finds the next match after a rune of context, and reWhole and reWholeAfter
+	// match only the whole string, the latter after a rune of context, so that ^ and \b
+	// keep their meaning when -w retries matches inside a line.
+	reNext, reWhole, reWholeAfter *regexp.Regexp
+	// prefilter rejects the lines that re cannot match before it runs.
+	prefilter *prefilter
+	ac        *ahoCorasick
+	accept    acAccept
+	// perPattern holds a search for each pattern, for MatchingPatterns.
+	perPattern []*Search
 
-	preContext      int
-	afterContext    int
-	isPreCtx        bool
-	preCtxTextBuf   []string
-	preCtxStrNumBuf []string
-	afterCtxCount   int
+	isFixString  bool
+	isIgnoreCase bool
+	isSmartCase  bool
+	isWord       bool
+	isLine       bool
+	// foldCase is set if the search is case-insensitive after applying isIgnoreCase and isSmartCase.
+	foldCase bool
 
-	output    func(args ...string)
-	outputArr []string
+	preContext    int
+	afterContext  int
+	isPreCtx      bool
+	preCtx        []ctxLine
+	afterCtxCount int
+
+	output func(s *Search, text string, n int, sep byte)
+	// printsLines is set if the output prints the selected lines themselves,
+	// which a binary file replaces with a single message.
+	printsLines bool
+	outputArr   []string
+	writer      io.Writer
+	writeErr    error
 
 	count int
 
+	onlyMatching bool
+
+	// stopOnMatch stops the search at the first selected line.
+	stopOnMatch bool
+	selected    int
+	stopped     bool
+
+	filesWithoutMatch bool
+	nullAfterName     bool
+
+	maxCount   int
+	isMaxCount bool
+
+	maxLineLength int
+	longLines     LongLines
+
+	binaryFiles BinaryFiles
+	decompress  bool
+
+	// lines reads the input; its buffers are reused by the next search.
+	lines *lineReader
+
+	// parallelism is the number of goroutines matching the lines of an input.
+	parallelism int
+	// precomputed is the result of the matcher for the current line in a parallel search.
+	precomputed bool
+
 	enableStringNumber bool
 
-	toCase func(text string) string
+	fileName string
+	// inputName names the input in messages when there is no file name prefix.
+	inputName string
+
+	colors *colors
 
 	isInvert bool
 }
 
 // New returns a new search with default settings.
-func New(searchWord string) *Search {
+// A line matches if any of the patterns matches it; with no patterns nothing matches.
+// It returns a *PatternError if a pattern is not a valid regular expression.
+func New(patterns ...string) (*Search, error) {
 	s := &Search{
-		searchWord: searchWord,
-		toCase:     skipCase,
+		patterns: slices.Clone(patterns),
+		writer:   os.Stdout,
+	}
+	s.output = (*Search).defaultOutput
+	s.printsLines = true
+	s.search = (*Search).searchDefault
+	if err := s.compile(); err != nil {
+		return nil, err
 	}
-	s.output = s.defaultOutput
-	s.search = s.searchDefault
 
-	s.match = s.matchRegexp
-	var err error
-	s.re, err = regexp.Compile(searchWord)
-	if err != nil {
-		log.Fatal("Regular expression compilation error:", err)
+	return s, nil
+}
+
+// NewFixed returns a new search that treats the patterns as fixed strings,
+// as if MatchFixString was called, so they do not have to be valid regular expressions.
+func NewFixed(patterns ...string) *Search {
+	s := &Search{
+		patterns:    slices.Clone(patterns),
+		writer:      os.Stdout,
+		isFixString: true,
 	}
+	s.output = (*Search).defaultOutput
+	s.printsLines = true
+	s.search = (*Search).searchDefault
+	s.compile()
 
 	return s
 }
 
+// Clone returns a copy of the search with the same patterns and options.
+// The copy shares the compiled patterns, which are safe for concurrent use,
+// but not the state of a search, so that the copies can search concurrently.
+// Set a separate writer for each copy with SetWriter.
+func (s *Search) Clone() *Search {
+	c := *s
+	c.preCtx = make([]ctxLine, len(s.preCtx))
+	if s.outputArr != nil {
+		c.outputArr = []string{}
+	}
+	c.perPattern = nil
+	c.lines = nil
+	return &c
+}
+
 // AddContext adds surrounding lines to search results.
 // The pre parameter specifies how many lines before,
 // and after specifies how many lines after the match to include.
 func (s *Search) AddContext(pre, after int) {
 	s.preContext = pre
 	s.afterContext = after
-	s.search = s.searchInFileWithContext
+	s.search = (*Search).searchInFileWithContext
 	s.isPreCtx = false
-	s.preCtxTextBuf = make([]string, s.preContext)
-	s.preCtxStrNumBuf = make([]string, s.preContext)
+	s.preCtx = make([]ctxLine, s.preContext)
 	s.afterCtxCount = 0
 }
 
+// SetWriter sets the writer the found strings are written to.
+// By default they are written to the standard output.
+func (s *Search) SetWriter(w io.Writer) {
+	s.writer = w
+}
+
 // EnableOutputToArray enables output into an array.
 func (s *Search) EnableOutputToArray() {
 	s.outputArr = []string{}
-	s.output = s.toArrayOutput
+	s.output = (*Search).toArrayOutput
+	s.printsLines = true
 }
 
 // GetArrayOutput returns the output array.
@@ -82,70 +173,380 @@ func (s *Search) GetArrayOutput() []string {
 
 // EnableCountOutput enables the output to display only the count of matches.
 func (s *Search) EnableCountOutput() {
-	s.output = s.countOutput
+	s.output = (*Search).countOutput
+	s.printsLines = false
 }
 
-// GetCountOutput returns the count of matches found.
+// GetCountOutput returns the count of matches found by the last search.
 func (s *Search) GetCountOutput() int {
 	return s.count
 }
 
+// EnableOnlyMatchingOutput enables the output to display only the matched parts
+// of the found strings, each on a separate line. Context lines are not output.
+func (s *Search) EnableOnlyMatchingOutput() {
+	s.onlyMatching = true
+}
+
+// EnableQuietOutput disables the output and stops the search at the first selected line.
+// Use Matched to find out whether anything was found.
+func (s *Search) EnableQuietOutput() {
+	s.stopOnMatch = true
+	s.output = (*Search).quietOutput
+	s.printsLines = false
+}
+
+// EnableFilesWithMatchesOutput enables the output to display only the file name,
+// set by SetFileName, if the file has a selected line. The search stops at the first one.
+func (s *Search) EnableFilesWithMatchesOutput() {
+	s.stopOnMatch = true
+	s.output = (*Search).fileNameOutput
+	s.printsLines = false
+}
+
+// EnableFilesWithoutMatchOutput enables the output to display only the file name,
+// set by SetFileName, if the file has no selected lines. The search stops at the first one.
+func (s *Search) EnableFilesWithoutMatchOutput() {
+	s.stopOnMatch = true
+	s.filesWithoutMatch = true
+	s.output = (*Search).quietOutput
+	s.printsLines = false
+}
+
+// EnableNullAfterFileName makes the output put a zero byte after file names
+// instead of the usual separator or newline, as the -Z flag of GNU grep does.
+func (s *Search) EnableNullAfterFileName() {
+	s.nullAfterName = true
+}
+
+// Matched reports whether the last search selected at least one line.
+func (s *Search) Matched() bool {
+	return s.selected > 0
+}
+
+// SetMaxCount stops reading the input after n selected lines.
+// The context after the last selected line is still output.
+// A negative n removes the limit.
+func (s *Search) SetMaxCount(n int) {
+	s.maxCount = n
+	s.isMaxCount = n >= 0
+}
+
+// SetMaxLineLength limits the length of the lines in bytes.
+// The longer lines are truncated or skipped, depending on longLines.
+// A zero or negative n removes the limit, so lines of any length are searched.
+func (s *Search) SetMaxLineLength(n int, longLines LongLines) {
+	s.maxLineLength = n
+	s.longLines = longLines
+}
+
+// SetBinaryFiles sets how the inputs that look like binary data are searched.
+// An input is binary if its first chunk has a NUL byte or is not valid UTF-8.
+func (s *Search) SetBinaryFiles(binaryFiles BinaryFiles) {
+	s.binaryFiles = binaryFiles
+}
+
+// SetParallelism makes the search match the lines of an input in chunks
+// by up to n goroutines, which pays off for a single large input.
+// The output is the same as of a sequential search. An n of 1 or less
+// searches sequentially, which is the default.
+func (s *Search) SetParallelism(n int) {
+	s.parallelism = n
+}
+
+// EnableDecompression makes the search detect gzip, bzip2 and zlib inputs
+// by their magic bytes and search their decompressed contents,
+// so that line numbers and context refer to the decompressed lines.
+func (s *Search) EnableDecompression() {
+	s.decompress = true
+}
+
 // EnableStringNumberOutput enables the output to display number of found strings.
 func (s *Search) EnableStringNumberOutput() {
 	s.enableStringNumber = true
 }
 
-// IgnoreCase enables case-insensitive search.
-func (s *Search) IgnoreCase() {
-	s.toCase = toLowerCase
-	var err error
-	s.searchWord = strings.ToLower(s.searchWord)
-	if s.re != nil {
-		s.re, err = regexp.Compile(s.searchWord)
-		if err != nil {
-			log.Fatal("Regular expression compilation error:", err)
-		}
-	}
+// EnableColorOutput enables highlighting of the matches, file names, line numbers
+// and separators with ANSI escape sequences. The spec overrides the default colors
+// in the format of the GREP_COLORS environment variable of GNU grep, e.g. "ms=01;32:fn=34".
+func (s *Search) EnableColorOutput(spec string) {
+	s.colors = parseColors(spec)
+}
+
+// SetFileName sets the name printed before each output line.
+// An empty name disables the prefix.
+func (s *Search) SetFileName(name string) {
+	s.fileName = name
+}
+
+// SetInputName sets the name of the input used where the output names the file
+// itself, e.g. with EnableFilesWithMatchesOutput or for binary files,
+// if no name is set by SetFileName. By default it is "(standard input)".
+func (s *Search) SetInputName(name string) {
+	s.inputName = name
+}
+
+// IgnoreCase enables case-insensitive search with Unicode case folding.
+// Neither the patterns nor the output strings are changed.
+// It returns a *PatternError if a pattern cannot be compiled.
+func (s *Search) IgnoreCase() error {
+	s.isIgnoreCase = true
+	return s.compile()
+}
+
+// SmartCase enables case-insensitive search if none of the patterns
+// contains an uppercase letter, and case-sensitive search otherwise.
+// For regular expressions only the literal characters count,
+// not escapes like \S or class names like \p{Lu}.
+// It returns a *PatternError if a pattern cannot be compiled.
+func (s *Search) SmartCase() error {
+	s.isSmartCase = true
+	return s.compile()
+}
+
+// MatchWord selects only the matches that form whole words, i.e. are preceded
+// and followed by a non-word character or the edge of the line.
+// Word characters are letters, digits and the underscore.
+// It returns a *PatternError if a pattern cannot be compiled.
+func (s *Search) MatchWord() error {
+	s.isWord = true
+	return s.compile()
+}
+
+// MatchLine selects only the matches that form the whole line.
+// It takes precedence over MatchWord.
+// It returns a *PatternError if a pattern cannot be compiled.
+func (s *Search) MatchLine() error {
+	s.isLine = true
+	return s.compile()
 }
 
 // MatchFixString allows you to treat a template as a fixed string, rather than as a regex.
+// Several fixed strings are searched for in a single pass with the Aho-Corasick algorithm.
 func (s *Search) MatchFixString() {
-	s.match = s.matchFixString
-	s.re = nil
+	s.isFixString = true
+	s.compile()
+}
+
+// MatchingPatterns returns the indices of the patterns that match the text,
+// in the order the patterns were given.
+func (s *Search) MatchingPatterns(text string) []int {
+	if s.ac != nil {
+		return s.ac.patternsIn(text, s.accept)
+	}
+
+	if s.perPattern == nil {
+		s.perPattern = make([]*Search, len(s.patterns))
+		for i, pattern := range s.patterns {
+			s.perPattern[i] = &Search{
+				patterns:     []string{pattern},
+				isFixString:  s.isFixString,
+				isIgnoreCase: s.foldCase,
+				isWord:       s.isWord,
+				isLine:       s.isLine,
+			}
+			// The patterns have already been checked by compile.
+			s.perPattern[i].compile()
+		}
+	}
+	var indices []int
+	for i, ps := range s.perPattern {
+		if ps.match(ps, text) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// compile prepares the matcher for the patterns and the current options.
+// It can only fail for regular expressions.
+func (s *Search) compile() error {
+	s.re, s.reNext, s.reWhole, s.reWholeAfter = nil, nil, nil, nil
+	s.prefilter, s.ac, s.accept, s.perPattern = nil, nil, nil, nil
+
+	ignoreCase := s.isIgnoreCase
+	if s.isSmartCase && !ignoreCase {
+		upper, err := hasUpper(s.patterns, s.isFixString)
+		if err != nil {
+			return err
+		}
+		ignoreCase = !upper
+	}
+	s.foldCase = ignoreCase
+
+	switch {
+	case !s.isFixString:
+		re, err := compileRegexp(s.patterns, ignoreCase)
+		if err != nil {
+			return err
+		}
+		s.re = re
+		s.prefilter = newPrefilter(re.String())
+		s.match = (*Search).matchRegexp
+		s.findAll = (*Search).findAllRegexp
+		if s.isLine {
+			s.re = regexp.MustCompile("^(?:" + re.String() + ")$")
+		} else if s.isWord {
+			s.reNext = regexp.MustCompile("(?s:.)(" + re.String() + ")")
+			s.reWhole = regexp.MustCompile("^(?:" + re.String() + ")$")
+			s.reWholeAfter = regexp.MustCompile("^(?s:.)(?:" + re.String() + ")$")
+			s.match = (*Search).matchWordRegexp
+			s.findAll = (*Search).findAllWordRegexp
+		}
+	case len(s.patterns) > 1 || ignoreCase || s.isLine || s.isWord:
+		s.ac = newAhoCorasick(s.patterns, ignoreCase)
+		if s.isLine {
+			s.accept = acceptLine
+		} else if s.isWord {
+			s.accept = acceptWord
+		}
+		s.match = (*Search).matchAhoCorasick
+		s.findAll = (*Search).findAllAhoCorasick
+	default:
+		s.match = (*Search).matchFixString
+		s.findAll = (*Search).findAllFixString
+	}
+	return nil
 }
 
 // Invert inverts the filter; outputs lines that do not contain a template.
 func (s *Search) Invert() {
 	s.isInvert = true
 	if s.preContext != 0 || s.afterContext != 0 {
-		s.search = s.searchInFileWithContextInvert
+		s.search = (*Search).searchInFileWithContextInvert
 	} else {
-		s.search = s.searchDefaultInvert
+		s.search = (*Search).searchDefaultInvert
 	}
 }
 
 // SearchInFile searches strings in a file.
-func (s *Search) SearchInFile(file *os.File) {
-	scanner := bufio.NewScanner(file)
-	i := 1
-	for scanner.Scan() {
-		text := scanner.Text()
-		if s.enableStringNumber {
-			s.search(text, i)
-			i++
-		} else {
-			s.search(text, 0)
+// It returns an *IOError if the file cannot be read or the output cannot be written.
+func (s *Search) SearchInFile(file *os.File) error {
+	return s.SearchReader(file, s.writer)
+}
+
+// SearchReader searches strings read from r and writes the found ones to w.
+// The writer w is kept for subsequent searches, as if set by SetWriter.
+// It returns an *IOError if r cannot be read or w cannot be written.
+func (s *Search) SearchReader(r io.Reader, w io.Writer) error {
+	s.writer = w
+	s.reset()
+
+	if s.decompress {
+		var err error
+		r, err = decompress(r)
+		if err != nil {
+			return &IOError{Op: "read", Name: s.fileName, Err: err}
 		}
 	}
+
+	if s.lines == nil {
+		s.lines = newLineReader(r, s.maxLineLength)
+	} else {
+		s.lines.reset(r, s.maxLineLength)
+	}
+	lines := s.lines
+	binary := false
+	if s.binaryFiles != BinaryFilesText && !s.maxReached() {
+		var err error
+		binary, err = lines.isBinary()
+		if err != nil {
+			return &IOError{Op: "read", Name: s.fileName, Err: err}
+		}
+	}
+	if binary && s.binaryFiles == BinaryFilesWithoutMatch {
+		if s.filesWithoutMatch {
+			s.writeFileName()
+		}
+		return s.writeError()
+	}
+	if binary && s.printsLines {
+		output := s.output
+		s.output = (*Search).binaryOutput
+		defer func() { s.output = output }()
+	}
+
+	var readErr error
+	s.stopped = s.maxReached()
+	if s.parallelism > 1 && !s.stopped {
+		readErr = s.searchChunks(lines.r, s.parallelism)
+		// After an early stop the reader of the chunks may still be reading,
+		// so its buffer is not reused.
+		s.lines = nil
+	} else {
+		readErr = s.searchLines(lines)
+	}
 	if s.isInvert && s.preContext > 0 && s.afterCtxCount <= 0 {
-		for i := len(s.preCtxTextBuf) - 1; i >= 0; i-- {
-			if s.preCtxTextBuf[i] != "" {
-				s.output(s.preCtxTextBuf[i], s.preCtxStrNumBuf[i])
+		for i := len(s.preCtx) - 1; i >= 0; i-- {
+			if s.preCtx[i].ok {
+				s.selectLine(bytesView(s.preCtx[i].text), s.preCtx[i].n)
 			}
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatal("File reading error:", err)
+	if readErr != nil {
+		return &IOError{Op: "read", Name: s.fileName, Err: readErr}
+	}
+	if binary && s.printsLines && s.selected > 0 {
+		s.binaryMatchesOutput()
+	}
+	if s.filesWithoutMatch && s.selected == 0 {
+		s.writeFileName()
+	}
+	return s.writeError()
+}
+
+// searchLines searches the lines of the input one by one.
+// If only the matching lines are output, the lines before the first
+// occurrence of the literals of the prefilter are skipped in the buffer.
+func (s *Search) searchLines(lines *lineReader) error {
+	skip := s.prefilter != nil && !s.isInvert && s.preContext == 0 && s.afterContext == 0
+	for i := 1; !s.stopped; i++ {
+		if skip {
+			i += lines.skipLines(s.prefilter.index)
+		}
+		text, long, err := lines.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !long || s.longLines != SkipLongLines {
+			s.searchLine(bytesView(text), i)
+		}
+	}
+	return nil
+}
+
+// searchLine searches the line with the number i.
+func (s *Search) searchLine(text string, i int) {
+	search := s.search
+	if s.maxReached() {
+		search = (*Search).searchTrailingContext
+	}
+	if !s.enableStringNumber {
+		i = 0
+	}
+	search(s, text, i)
+}
+
+// writeError returns an *IOError if the output of the last search could not be written.
+func (s *Search) writeError() error {
+	if s.writeErr != nil {
+		return &IOError{Op: "write", Name: s.fileName, Err: s.writeErr}
 	}
+	return nil
+}
+
+// reset clears the state left over from a previous search,
+// so that context and counts do not carry over from one file to the next.
+func (s *Search) reset() {
+	s.isPreCtx = false
+	s.clearPreCtx()
+	s.afterCtxCount = 0
+	s.count = 0
+	s.selected = 0
+	s.stopped = false
+	s.writeErr = nil
 }
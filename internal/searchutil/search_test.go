@@ -1,10 +1,22 @@
 package searchutil
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"regexp/syntax"
+	"runtime"
 	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestSearchInFileWithContext(t *testing.T) {
@@ -64,6 +76,21 @@ func TestSearchInFileWithContext(t *testing.T) {
 			afterContext: 2,
 			exp:          []string{"yes", "no", "no", "no", "yes"},
 		},
+		{
+			data:         []byte("one\n" + "\n" + "two\n"),
+			search:       "two",
+			preContext:   2,
+			afterContext: 0,
+			exp:          []string{"one", "", "two"},
+		},
+		{
+			// The lines span several read buffers, which the kept lines must not share.
+			data:         []byte(strings.Repeat(strings.Repeat("x", 1000)+"\n", 100) + "two\n" + strings.Repeat("y", 1000) + "\n"),
+			search:       "two",
+			preContext:   1,
+			afterContext: 1,
+			exp:          []string{strings.Repeat("x", 1000), "two", strings.Repeat("y", 1000)},
+		},
 	}
 
 	for i, test := range tests {
@@ -74,10 +101,15 @@ func TestSearchInFileWithContext(t *testing.T) {
 				os.Remove(file.Name())
 			})
 
-			s := New(test.search)
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			s.AddContext(test.preContext, test.afterContext)
 			s.EnableOutputToArray()
-			s.SearchInFile(file)
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			act := s.GetArrayOutput()
 			if !slices.Equal(act, test.exp) {
@@ -113,9 +145,14 @@ func TestSearchInFileEnableCounts(t *testing.T) {
 				os.Remove(file.Name())
 			})
 
-			s := New(test.search)
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			s.EnableCountOutput()
-			s.SearchInFile(file)
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			act := s.GetCountOutput()
 			if act != test.exp {
@@ -192,10 +229,15 @@ func TestSearchInFileEnableCountsWithContext(t *testing.T) {
 				os.Remove(file.Name())
 			})
 
-			s := New(test.search)
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			s.AddContext(test.preContext, test.afterContext)
 			s.EnableCountOutput()
-			s.SearchInFile(file)
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			act := s.GetCountOutput()
 			if act != test.exp {
@@ -231,10 +273,15 @@ func TestSearchInFileEnableStringNumbers(t *testing.T) {
 				os.Remove(file.Name())
 			})
 
-			s := New(test.search)
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			s.EnableOutputToArray()
 			s.EnableStringNumberOutput()
-			s.SearchInFile(file)
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			act := s.GetArrayOutput()
 			if !slices.Equal(act, test.exp) {
@@ -270,10 +317,17 @@ func TestSearchInFileWithIgnoreCase(t *testing.T) {
 				os.Remove(file.Name())
 			})
 
-			s := New(test.search)
-			s.IgnoreCase()
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := s.IgnoreCase(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			s.EnableOutputToArray()
-			s.SearchInFile(file)
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			act := s.GetArrayOutput()
 			if !slices.Equal(act, test.exp) {
@@ -283,6 +337,323 @@ func TestSearchInFileWithIgnoreCase(t *testing.T) {
 	}
 }
 
+func TestSearchInFileWithIgnoreCaseFolding(t *testing.T) {
+	tests := []struct {
+		data         []byte
+		search       []string
+		fixString    bool
+		onlyMatching bool
+		exp          []string
+	}{
+		{
+			data:   []byte("a ConnError\n" + "connERROR\n" + " error\n"),
+			search: []string{`\S+Error`},
+			exp:    []string{"a ConnError", "connERROR"},
+		},
+		{
+			data:   []byte("A-B\n" + "a b\n"),
+			search: []string{`a\Wb`, `\D\B`},
+			exp:    []string{"A-B", "a b"},
+		},
+		{
+			data:      []byte("\u212a\n" + "K\n" + "x\n"),
+			search:    []string{"k"},
+			fixString: true,
+			exp:       []string{"\u212a", "K"},
+		},
+		{
+			data:         []byte("ΟΔΟΣ café\n" + "CAFÉ\n"),
+			search:       []string{"σ", "É"},
+			fixString:    true,
+			onlyMatching: true,
+			exp:          []string{"Σ", "é", "É"},
+		},
+		{
+			data:         []byte("\u212aB and kb\n"),
+			search:       []string{"Kb"},
+			onlyMatching: true,
+			exp:          []string{"\u212aB", "kb"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			file := createFile(t, test.data)
+			t.Cleanup(func() {
+				file.Close()
+				os.Remove(file.Name())
+			})
+
+			var s *Search
+			if test.fixString {
+				s = NewFixed(test.search...)
+			} else {
+				var err error
+				s, err = New(test.search...)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if err := s.IgnoreCase(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.onlyMatching {
+				s.EnableOnlyMatchingOutput()
+			}
+			s.EnableOutputToArray()
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := s.GetArrayOutput()
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchInFileSmartCase(t *testing.T) {
+	tests := []struct {
+		data      []byte
+		search    string
+		fixString bool
+		exp       []string
+	}{
+		{
+			data:   []byte("error\n" + "Error\n" + "ERROR\n"),
+			search: "error",
+			exp:    []string{"error", "Error", "ERROR"},
+		},
+		{
+			data:   []byte("error\n" + "Error\n" + "ERROR\n"),
+			search: "Error",
+			exp:    []string{"Error"},
+		},
+		{
+			data:   []byte("fooerror\n" + "fooERROR\n" + " error\n"),
+			search: `\S+error`,
+			exp:    []string{"fooerror", "fooERROR"},
+		},
+		{
+			data:   []byte("Ax\n" + "AX\n" + "ax\n"),
+			search: `\p{Lu}x`,
+			exp:    []string{"Ax", "AX", "ax"},
+		},
+		{
+			data:      []byte("a.b\n" + "A.B\n"),
+			search:    "A.b",
+			fixString: true,
+			exp:       []string{},
+		},
+		{
+			data:      []byte("a.b\n" + "A.B\n"),
+			search:    "a.b",
+			fixString: true,
+			exp:       []string{"a.b", "A.B"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			file := createFile(t, test.data)
+			t.Cleanup(func() {
+				file.Close()
+				os.Remove(file.Name())
+			})
+
+			var s *Search
+			if test.fixString {
+				s = NewFixed(test.search)
+			} else {
+				var err error
+				s, err = New(test.search)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if err := s.SmartCase(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			s.EnableOutputToArray()
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := s.GetArrayOutput()
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchInFileMatchWord(t *testing.T) {
+	tests := []struct {
+		data         []byte
+		search       []string
+		fixString    bool
+		onlyMatching bool
+		exp          []string
+	}{
+		{
+			data:   []byte("id=1\n" + "valid\n" + "user_id\n" + "(id)\n"),
+			search: []string{"id"},
+			exp:    []string{"id=1", "(id)"},
+		},
+		{
+			data:      []byte("id=1\n" + "valid\n" + "user_id\n" + "(id)\n"),
+			search:    []string{"id"},
+			fixString: true,
+			exp:       []string{"id=1", "(id)"},
+		},
+		{
+			data:         []byte("valid id\n"),
+			search:       []string{"id"},
+			fixString:    true,
+			onlyMatching: true,
+			exp:          []string{"id"},
+		},
+		{
+			data:         []byte("a b bc\n"),
+			search:       []string{"a.*b"},
+			onlyMatching: true,
+			exp:          []string{"a b"},
+		},
+		{
+			data:         []byte("abc ab\n"),
+			search:       []string{"ab", "abc d"},
+			fixString:    true,
+			onlyMatching: true,
+			exp:          []string{"ab"},
+		},
+		{
+			data:   []byte("éa\n" + "é a\n"),
+			search: []string{"a"},
+			exp:    []string{"é a"},
+		},
+		{
+			data:   []byte("-b\n" + "b-\n"),
+			search: []string{"^b|-"},
+			exp:    []string{"b-"},
+		},
+		{
+			data:   []byte("-b-cz\n" + "b-cz\n"),
+			search: []string{`b-c|^b`},
+			exp:    []string{"b-cz"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			file := createFile(t, test.data)
+			t.Cleanup(func() {
+				file.Close()
+				os.Remove(file.Name())
+			})
+
+			var s *Search
+			if test.fixString {
+				s = NewFixed(test.search...)
+			} else {
+				var err error
+				s, err = New(test.search...)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if err := s.MatchWord(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.onlyMatching {
+				s.EnableOnlyMatchingOutput()
+			}
+			s.EnableOutputToArray()
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := s.GetArrayOutput()
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchInFileMatchLine(t *testing.T) {
+	tests := []struct {
+		data       []byte
+		search     []string
+		fixString  bool
+		ignoreCase bool
+		exp        []string
+	}{
+		{
+			data:   []byte("one\n" + "one two\n" + "two\n" + "\n"),
+			search: []string{"one|two"},
+			exp:    []string{"one", "two"},
+		},
+		{
+			data:      []byte("one\n" + "one two\n" + "two\n" + "\n"),
+			search:    []string{"one", "two"},
+			fixString: true,
+			exp:       []string{"one", "two"},
+		},
+		{
+			data:       []byte("One\n" + "one two\n"),
+			search:     []string{"one"},
+			fixString:  true,
+			ignoreCase: true,
+			exp:        []string{"One"},
+		},
+		{
+			data:      []byte("one\n" + "\n"),
+			search:    []string{""},
+			fixString: true,
+			exp:       []string{""},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			file := createFile(t, test.data)
+			t.Cleanup(func() {
+				file.Close()
+				os.Remove(file.Name())
+			})
+
+			var s *Search
+			if test.fixString {
+				s = NewFixed(test.search...)
+			} else {
+				var err error
+				s, err = New(test.search...)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if test.ignoreCase {
+				if err := s.IgnoreCase(); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if err := s.MatchLine(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			s.EnableOutputToArray()
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := s.GetArrayOutput()
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
 func TestSearchInFileMatchFixString(t *testing.T) {
 	tests := []struct {
 		data   []byte
@@ -309,10 +680,15 @@ func TestSearchInFileMatchFixString(t *testing.T) {
 				os.Remove(file.Name())
 			})
 
-			s := New(test.search)
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			s.MatchFixString()
 			s.EnableOutputToArray()
-			s.SearchInFile(file)
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			act := s.GetArrayOutput()
 			if !slices.Equal(act, test.exp) {
@@ -348,10 +724,15 @@ func TestSearchInFileInvert(t *testing.T) {
 				os.Remove(file.Name())
 			})
 
-			s := New(test.search)
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			s.Invert()
 			s.EnableOutputToArray()
-			s.SearchInFile(file)
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			act := s.GetArrayOutput()
 			if !slices.Equal(act, test.exp) {
@@ -428,11 +809,16 @@ func TestSearchInFileWithContextInvert(t *testing.T) {
 				os.Remove(file.Name())
 			})
 
-			s := New(test.search)
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			s.AddContext(test.preContext, test.afterContext)
 			s.EnableOutputToArray()
 			s.Invert()
-			s.SearchInFile(file)
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			act := s.GetArrayOutput()
 			if !slices.Equal(act, test.exp) {
@@ -509,11 +895,16 @@ func TestSearchInFileWithContextInvertEnableCounts(t *testing.T) {
 				os.Remove(file.Name())
 			})
 
-			s := New(test.search)
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 			s.AddContext(test.preContext, test.afterContext)
 			s.EnableCountOutput()
 			s.Invert()
-			s.SearchInFile(file)
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			act := s.GetCountOutput()
 			if act != test.exp {
@@ -523,6 +914,1239 @@ func TestSearchInFileWithContextInvertEnableCounts(t *testing.T) {
 	}
 }
 
+func TestSearchInFileWithFileName(t *testing.T) {
+	tests := []struct {
+		data         [][]byte
+		names        []string
+		search       string
+		exp          []string
+		preContext   int
+		afterContext int
+	}{
+		{
+			data:   [][]byte{[]byte("one\n" + "two\n"), []byte("three\n")},
+			names:  []string{"a.txt", "b.txt"},
+			search: "o",
+			exp:    []string{"a.txt:one", "a.txt:two"},
+		},
+		{
+			data:         [][]byte{[]byte("one\n" + "two\n"), []byte("three\n" + "four\n")},
+			names:        []string{"a.txt", "b.txt"},
+			search:       "four",
+			preContext:   2,
+			afterContext: 0,
+			exp:          []string{"b.txt-three", "b.txt:four"},
+		},
+		{
+			data:         [][]byte{[]byte("one\n" + "two\n"), []byte("three\n" + "four\n")},
+			names:        []string{"a.txt", "b.txt"},
+			search:       "two",
+			preContext:   0,
+			afterContext: 2,
+			exp:          []string{"a.txt:two"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.preContext != 0 || test.afterContext != 0 {
+				s.AddContext(test.preContext, test.afterContext)
+			}
+			s.EnableOutputToArray()
+
+			for j, data := range test.data {
+				file := createFile(t, data)
+				t.Cleanup(func() {
+					file.Close()
+					os.Remove(file.Name())
+				})
+
+				s.SetFileName(test.names[j])
+				if err := s.SearchInFile(file); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			act := s.GetArrayOutput()
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchReader(t *testing.T) {
+	tests := []struct {
+		data   string
+		search string
+		exp    string
+	}{
+		{
+			data:   "one\n" + "two\n" + "three\n",
+			search: "three",
+			exp:    "three\n",
+		},
+		{
+			data:   "one\n" + "two\n" + "three\n",
+			search: "o",
+			exp:    "one\n" + "two\n",
+		},
+		{
+			data:   "one\n" + "two\n" + "three\n",
+			search: "four",
+			exp:    "",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := s.SearchReader(strings.NewReader(test.data), &buf); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := buf.String()
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchReaderLongLines(t *testing.T) {
+	long := strings.Repeat("x", 5<<20)
+	tests := []struct {
+		data      string
+		search    string
+		max       int
+		longLines LongLines
+		exp       string
+	}{
+		{
+			data:   "one\n" + long + "end\n" + "three\n",
+			search: "end",
+			exp:    "2: " + long + "end\n",
+		},
+		{
+			data:   "one\r\n" + long + "\r\n" + "three",
+			search: "e$",
+			exp:    "1: one\n" + "3: three\n",
+		},
+		{
+			data:   "one\n" + "twelve\n" + "three\n",
+			search: "e",
+			max:    4,
+			exp:    "1: one\n" + "2: twel\n" + "3: thre\n",
+		},
+		{
+			data:   "one\n" + long + "end\n" + "three\n",
+			search: "end",
+			max:    1 << 20,
+			exp:    "",
+		},
+		{
+			data:      "one\n" + "twelve\n" + "three\n",
+			search:    "e",
+			max:       4,
+			longLines: SkipLongLines,
+			exp:       "1: one\n",
+		},
+		{
+			data:      "one\r\n" + "four\r\n",
+			search:    "o",
+			max:       4,
+			longLines: SkipLongLines,
+			exp:       "1: one\n" + "2: four\n",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			s.EnableStringNumberOutput()
+			s.SetMaxLineLength(test.max, test.longLines)
+			if err := s.SearchReader(strings.NewReader(test.data), &buf); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := buf.String()
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%.200q\nExpected:\n%.200q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchReaderBinaryFiles(t *testing.T) {
+	tests := []struct {
+		data        string
+		search      string
+		binaryFiles BinaryFiles
+		count       bool
+		exp         string
+	}{
+		{
+			data:   "one\x00\n" + "two\n" + "three\n",
+			search: "o",
+			exp:    "Binary file a.bin matches\n",
+		},
+		{
+			data:   "one\xff\n" + "two\n",
+			search: "four",
+			exp:    "",
+		},
+		{
+			data:   "один\n" + "два\n",
+			search: "д",
+			exp:    "один\n" + "два\n",
+		},
+		{
+			data:        "one\x00\n" + "two\n" + "three\n",
+			search:      "o",
+			binaryFiles: BinaryFilesText,
+			exp:         "one\x00\n" + "two\n",
+		},
+		{
+			data:        "one\x00\n" + "two\n" + "three\n",
+			search:      "o",
+			binaryFiles: BinaryFilesWithoutMatch,
+			exp:         "",
+		},
+		{
+			data:   "one\x00\n" + "two\n" + "three\n",
+			search: "o",
+			count:  true,
+			exp:    "",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.count {
+				s.EnableCountOutput()
+			}
+			s.SetBinaryFiles(test.binaryFiles)
+			s.SetInputName("a.bin")
+			if err := s.SearchReader(strings.NewReader(test.data), &buf); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := buf.String()
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+			if test.count && s.GetCountOutput() != 2 {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", s.GetCountOutput(), 2)
+			}
+		})
+	}
+}
+
+func TestSearchReaderDecompression(t *testing.T) {
+	text := "one\n" + "two\n" + "three\n"
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(text))
+	gw.Close()
+
+	var zl bytes.Buffer
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte(text))
+	zw.Close()
+
+	// The output of "printf 'one\ntwo\nthree\n' | bzip2", as the standard library cannot compress.
+	bz := "\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\x08\x7b\x7d\xd7\x00\x00\x04\xc1\x80\x00\x10\x02\x41\x94\x80\x20\x00\x31\x0c\x08\x21\xa3\xd4\xc8\x85\x47\x32\x38\xa8\xf1\x77\x24\x53\x85\x09\x00\x87\xb7\xdd\x70"
+
+	tests := []struct {
+		data string
+		exp  string
+	}{
+		{
+			data: gz.String(),
+			exp:  "1- one\n" + "2: two\n" + "3- three\n",
+		},
+		{
+			data: bz,
+			exp:  "1- one\n" + "2: two\n" + "3- three\n",
+		},
+		{
+			data: zl.String(),
+			exp:  "1- one\n" + "2: two\n" + "3- three\n",
+		},
+		{
+			data: text,
+			exp:  "1- one\n" + "2: two\n" + "3- three\n",
+		},
+		{
+			data: "x^two\n",
+			exp:  "1: x^two\n",
+		},
+		{
+			data: "",
+			exp:  "",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			s, err := New("two")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			s.AddContext(1, 1)
+			s.EnableStringNumberOutput()
+			s.EnableDecompression()
+			if err := s.SearchReader(strings.NewReader(test.data), &buf); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := buf.String()
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchInFileOnlyMatching(t *testing.T) {
+	tests := []struct {
+		data         []byte
+		search       string
+		fixString    bool
+		afterContext int
+		exp          []string
+	}{
+		{
+			data:   []byte("id=12 id=345\n" + "none\n" + "id=6\n"),
+			search: "[0-9]+",
+			exp:    []string{"12", "345", "6"},
+		},
+		{
+			data:   []byte("one\n" + "two\n" + "three\n"),
+			search: "x*",
+			exp:    []string{},
+		},
+		{
+			data:      []byte("a.b a.b\n" + "axb\n"),
+			search:    "a.b",
+			fixString: true,
+			exp:       []string{"a.b", "a.b"},
+		},
+		{
+			data:         []byte("one\n" + "two\n" + "three\n"),
+			search:       "on",
+			afterContext: 1,
+			exp:          []string{"on"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			file := createFile(t, test.data)
+			t.Cleanup(func() {
+				file.Close()
+				os.Remove(file.Name())
+			})
+
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.fixString {
+				s.MatchFixString()
+			}
+			if test.afterContext != 0 {
+				s.AddContext(0, test.afterContext)
+			}
+			s.EnableOnlyMatchingOutput()
+			s.EnableOutputToArray()
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := s.GetArrayOutput()
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchInFileColor(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		search   string
+		spec     string
+		fileName string
+		exp      []string
+	}{
+		{
+			data:   []byte("one\n" + "two\n"),
+			search: "o",
+			exp: []string{
+				"\x1b[01;31m\x1b[Ko\x1b[m\x1b[Kne",
+				"tw\x1b[01;31m\x1b[Ko\x1b[m\x1b[K",
+			},
+		},
+		{
+			data:     []byte("one\n" + "two\n"),
+			search:   "ne",
+			spec:     "ms=32:fn=:se=",
+			fileName: "a.txt",
+			exp:      []string{"a.txt:o\x1b[32m\x1b[Kne\x1b[m\x1b[K"},
+		},
+		{
+			data:     []byte("one\n"),
+			search:   "one",
+			spec:     "mt=:sl=1",
+			fileName: "a.txt",
+			exp:      []string{"\x1b[35m\x1b[Ka.txt\x1b[m\x1b[K\x1b[36m\x1b[K:\x1b[m\x1b[Kone"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			file := createFile(t, test.data)
+			t.Cleanup(func() {
+				file.Close()
+				os.Remove(file.Name())
+			})
+
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			s.EnableColorOutput(test.spec)
+			s.SetFileName(test.fileName)
+			s.EnableOutputToArray()
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := s.GetArrayOutput()
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchInFileMultiplePatterns(t *testing.T) {
+	tests := []struct {
+		data      []byte
+		search    []string
+		fixString bool
+		exp       []string
+	}{
+		{
+			data:   []byte("one\n" + "two\n" + "three\n"),
+			search: []string{"^t.o$", "ee"},
+			exp:    []string{"two", "three"},
+		},
+		{
+			data:      []byte("a.b\n" + "(x\n" + "three\n"),
+			search:    []string{"a.b", "("},
+			fixString: true,
+			exp:       []string{"a.b", "(x"},
+		},
+		{
+			data:   []byte("one\n" + "two\n" + "three\n"),
+			search: []string{},
+			exp:    []string{},
+		},
+		{
+			data:      []byte("one\n" + "two\n" + "three\n"),
+			search:    []string{},
+			fixString: true,
+			exp:       []string{},
+		},
+		{
+			data:   []byte("one\n" + "\n"),
+			search: []string{"two", ""},
+			exp:    []string{"one", ""},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			file := createFile(t, test.data)
+			t.Cleanup(func() {
+				file.Close()
+				os.Remove(file.Name())
+			})
+
+			var s *Search
+			if test.fixString {
+				s = NewFixed(test.search...)
+			} else {
+				var err error
+				s, err = New(test.search...)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			s.EnableOutputToArray()
+			if err := s.SearchInFile(file); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := s.GetArrayOutput()
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestMatchingPatterns(t *testing.T) {
+	tests := []struct {
+		text      string
+		search    []string
+		fixString bool
+		exp       []int
+	}{
+		{
+			text:   "error: timeout",
+			search: []string{"warn", "err(or)?", "time.ut"},
+			exp:    []int{1, 2},
+		},
+		{
+			text:      "error: timeout",
+			search:    []string{"warn", "error", "timeout", "out", "or:"},
+			fixString: true,
+			exp:       []int{1, 2, 3, 4},
+		},
+		{
+			text:      "error: timeout",
+			search:    []string{"time.ut"},
+			fixString: true,
+			exp:       nil,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			var s *Search
+			if test.fixString {
+				s = NewFixed(test.search...)
+			} else {
+				var err error
+				s, err = New(test.search...)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			act := s.MatchingPatterns(test.text)
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestAhoCorasick(t *testing.T) {
+	tests := []struct {
+		text     string
+		patterns []string
+	}{
+		{
+			text:     "ushers",
+			patterns: []string{"he", "she", "his", "hers"},
+		},
+		{
+			text:     "abcd abc ab",
+			patterns: []string{"ab", "abcd", "bc", "d a"},
+		},
+		{
+			text:     "aaaaaa",
+			patterns: []string{"aa", "aaa", ""},
+		},
+		{
+			text:     "xyz",
+			patterns: []string{"a", "b"},
+		},
+		{
+			text:     "BBbAbcaa",
+			patterns: []string{"a", "aac", "b"},
+		},
+		{
+			text:     "aa",
+			patterns: []string{"a", "aac"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			s := NewFixed(test.patterns...)
+			if s.ac == nil {
+				t.Fatalf("Aho-Corasick automaton is not used")
+			}
+
+			act := s.findAll(s, test.text)
+			exp := s.findAllFixString(test.text)
+			if !slices.EqualFunc(act, exp, slices.Equal) {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", act, exp)
+			}
+			if s.match(s, test.text) != s.matchFixString(test.text) {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", s.match(s, test.text), s.matchFixString(test.text))
+			}
+		})
+	}
+}
+
+func TestSearchInFileMaxCount(t *testing.T) {
+	tests := []struct {
+		data         []byte
+		search       string
+		maxCount     int
+		afterContext int
+		invert       bool
+		exp          []string
+	}{
+		{
+			data:     []byte("one\n" + "two\n" + "three\n" + "four\n"),
+			search:   "o",
+			maxCount: 2,
+			exp:      []string{"one", "two"},
+		},
+		{
+			data:     []byte("one\n" + "two\n" + "three\n"),
+			search:   "o",
+			maxCount: 0,
+			exp:      []string{},
+		},
+		{
+			data:     []byte("one\n" + "two\n" + "three\n"),
+			search:   "o",
+			maxCount: -1,
+			exp:      []string{"one", "two"},
+		},
+		{
+			data:         []byte("one\n" + "three\n" + "five\n" + "two\n"),
+			search:       "o",
+			maxCount:     1,
+			afterContext: 2,
+			exp:          []string{"one", "three", "five"},
+		},
+		{
+			data:         []byte("one\n" + "three\n" + "two\n" + "five\n"),
+			search:       "o",
+			maxCount:     1,
+			afterContext: 2,
+			exp:          []string{"one", "three", "two"},
+		},
+		{
+			data:     []byte("one\n" + "three\n" + "two\n" + "five\n"),
+			search:   "o",
+			maxCount: 1,
+			invert:   true,
+			exp:      []string{"three"},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.afterContext != 0 {
+				s.AddContext(0, test.afterContext)
+			}
+			if test.invert {
+				s.Invert()
+			}
+			s.SetMaxCount(test.maxCount)
+			s.EnableOutputToArray()
+
+			// The reader fails if the search reads past the data.
+			r := io.MultiReader(bytes.NewReader(test.data), iotest.ErrReader(errors.New("read too far")))
+			if err := s.SearchReader(r, io.Discard); err != nil && test.maxCount >= 0 {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := s.GetArrayOutput()
+			if !slices.Equal(act, test.exp) {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestSearchInFileQuiet(t *testing.T) {
+	tests := []struct {
+		data   []byte
+		search string
+		invert bool
+		exp    bool
+	}{
+		{
+			data:   []byte("one\n" + "two\n" + "three\n"),
+			search: "o",
+			exp:    true,
+		},
+		{
+			data:   []byte("one\n" + "two\n" + "three\n"),
+			search: "four",
+			exp:    false,
+		},
+		{
+			data:   []byte("one\n" + "two\n" + "three\n"),
+			search: "four",
+			invert: true,
+			exp:    true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.invert {
+				s.Invert()
+			}
+			s.EnableQuietOutput()
+			if err := s.SearchReader(bytes.NewReader(test.data), &buf); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := s.Matched()
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", act, test.exp)
+			}
+			if buf.Len() != 0 {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", buf.String(), "")
+			}
+		})
+	}
+}
+
+func TestSearchInFileListFiles(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		search   string
+		fileName string
+		without  bool
+		null     bool
+		exp      string
+	}{
+		{
+			data:     []byte("one\n" + "two\n" + "three\n"),
+			search:   "o",
+			fileName: "a.txt",
+			exp:      "a.txt\n",
+		},
+		{
+			data:     []byte("one\n" + "two\n" + "three\n"),
+			search:   "four",
+			fileName: "a.txt",
+			exp:      "",
+		},
+		{
+			data:   []byte("one\n" + "two\n" + "three\n"),
+			search: "o",
+			exp:    "(standard input)\n",
+		},
+		{
+			data:     []byte("one\n" + "two\n" + "three\n"),
+			search:   "o",
+			fileName: "a.txt",
+			null:     true,
+			exp:      "a.txt\x00",
+		},
+		{
+			data:     []byte("one\n" + "two\n" + "three\n"),
+			search:   "four",
+			fileName: "a.txt",
+			without:  true,
+			exp:      "a.txt\n",
+		},
+		{
+			data:     []byte("one\n" + "two\n" + "three\n"),
+			search:   "o",
+			fileName: "a.txt",
+			without:  true,
+			exp:      "",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.without {
+				s.EnableFilesWithoutMatchOutput()
+			} else {
+				s.EnableFilesWithMatchesOutput()
+			}
+			if test.null {
+				s.EnableNullAfterFileName()
+			}
+			s.SetFileName(test.fileName)
+			if err := s.SearchReader(bytes.NewReader(test.data), &buf); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			act := buf.String()
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	data := "one\n" + "two\n" + "three\n" + "four\n"
+	exp := "1- one\n" + "2: two\n" + "3- three\n"
+
+	s, err := New("two")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.AddContext(1, 1)
+	s.EnableStringNumberOutput()
+
+	var wg sync.WaitGroup
+	results := make([]string, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(c *Search) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			for range 100 {
+				buf.Reset()
+				if err := c.SearchReader(strings.NewReader(data), &buf); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}
+			results[i] = buf.String()
+		}(s.Clone())
+	}
+	wg.Wait()
+
+	for _, act := range results {
+		if act != exp {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, exp)
+		}
+	}
+}
+
+func TestSearchReaderParallel(t *testing.T) {
+	// The input spans several chunks, so that context crosses their boundaries.
+	var data strings.Builder
+	for i := 0; data.Len() < 3*chunkSize; i++ {
+		fmt.Fprintf(&data, "line %d %v\r\n", i, strings.Repeat("x", i%97))
+	}
+
+	tests := []struct {
+		search  string
+		options func(s *Search)
+	}{
+		{
+			search:  "7 x*$",
+			options: func(s *Search) {},
+		},
+		{
+			search: "x{90}",
+			options: func(s *Search) {
+				s.AddContext(2, 3)
+				s.EnableStringNumberOutput()
+			},
+		},
+		{
+			search: "x{3}",
+			options: func(s *Search) {
+				s.Invert()
+				s.EnableStringNumberOutput()
+			},
+		},
+		{
+			search: "line [0-9]*5 ",
+			options: func(s *Search) {
+				s.AddContext(0, 2)
+				s.SetMaxCount(2000)
+				s.EnableStringNumberOutput()
+			},
+		},
+		{
+			search: "x{50}",
+			options: func(s *Search) {
+				s.SetMaxLineLength(60, SkipLongLines)
+				s.EnableOnlyMatchingOutput()
+				s.EnableStringNumberOutput()
+			},
+		},
+		{
+			search: "9",
+			options: func(s *Search) {
+				s.EnableCountOutput()
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			var exp, act bytes.Buffer
+
+			s, err := New(test.search)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			test.options(s)
+			if err := s.SearchReader(strings.NewReader(data.String()), &exp); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expCount := s.GetCountOutput()
+			if exp.Len() == 0 && expCount == 0 {
+				t.Fatalf("The search found nothing")
+			}
+
+			s.SetParallelism(4)
+			if err := s.SearchReader(strings.NewReader(data.String()), &act); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if act.String() != exp.String() {
+				t.Fatalf("\nActual:\n%.300q\nExpected:\n%.300q", act.String(), exp.String())
+			}
+			if s.GetCountOutput() != expCount {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", s.GetCountOutput(), expCount)
+			}
+		})
+	}
+}
+
+func TestSearchReaderParallelLongLines(t *testing.T) {
+	// A single line of 64 MB, of which only the first 100 bytes are kept.
+	r := io.MultiReader(
+		strings.NewReader("one\n"),
+		io.LimitReader(repeatReader('x'), 64<<20),
+		strings.NewReader(" two\nthree two\n"),
+	)
+
+	s, err := New("two")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.SetMaxLineLength(100, TruncateLongLines)
+	s.SetParallelism(4)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var act bytes.Buffer
+	if err := s.SearchReader(r, &act); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	runtime.ReadMemStats(&after)
+
+	if exp := "three two\n"; act.String() != exp {
+		t.Fatalf("\nActual:\n%.300q\nExpected:\n%q", act.String(), exp)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Fatalf("\nActual:\n%v bytes allocated\nExpected:\nat most %v", alloc, 16<<20)
+	}
+}
+
+func TestSearchReaderParallelStop(t *testing.T) {
+	var data strings.Builder
+	for i := 0; data.Len() < 8*chunkSize; i++ {
+		fmt.Fprintf(&data, "line %d\n", i)
+	}
+
+	tests := []func(s *Search){
+		func(s *Search) { s.SetMaxCount(1) },
+		func(s *Search) { s.EnableFilesWithMatchesOutput() },
+		func(s *Search) { s.EnableQuietOutput() },
+	}
+
+	for i, options := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			s, err := New("line")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			options(s)
+			s.SetParallelism(4)
+
+			// The caller may go on reading the input, e.g. the next member of an archive,
+			// so it must not be read any more once the search returns.
+			r := &slowReader{r: strings.NewReader(data.String())}
+			if err := s.SearchReader(r, io.Discard); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if n := r.reading.Load(); n != 0 {
+				t.Fatalf("\nActual:\n%v reads in progress\nExpected:\n%v", n, 0)
+			}
+			read := r.reads.Load()
+			time.Sleep(50 * time.Millisecond)
+			if n := r.reads.Load(); n != read {
+				t.Fatalf("\nActual:\n%v reads after the search\nExpected:\n%v", n-read, 0)
+			}
+		})
+	}
+}
+
+// repeatReader reads the byte endlessly.
+type repeatReader byte
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+// slowReader counts the reads of r, which take some time and return at most 64 KB,
+// so that reading a chunk takes several reads.
+type slowReader struct {
+	r       io.Reader
+	reads   atomic.Int32
+	reading atomic.Int32
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	r.reads.Add(1)
+	r.reading.Add(1)
+	defer r.reading.Add(-1)
+	time.Sleep(time.Millisecond)
+	return r.r.Read(p[:min(len(p), 64<<10)])
+}
+
+func TestRequiredLiterals(t *testing.T) {
+	tests := []struct {
+		expr     string
+		literals []string
+		fold     bool
+	}{
+		{expr: "ERROR.*timeout", literals: []string{"timeout"}},
+		{expr: "a+bcd?e", literals: []string{"bc"}},
+		{expr: "(?:foo|bar)[0-9]+", literals: []string{"foo", "bar"}},
+		{expr: "x{2,}", literals: []string{"x"}},
+		{expr: "(?i)Error", literals: []string{"ERROR"}, fold: true},
+		{expr: "(?i:abc)|def", literals: []string{"ABC", "def"}, fold: true},
+		{expr: "foo|.*"},
+		{expr: "x*y?"},
+		{expr: "[ab]c?"},
+		{expr: "a�b"},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			re, err := syntax.Parse(test.expr, syntax.Perl)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			literals, fold, ok := requiredLiterals(re.Simplify())
+			if ok != (test.literals != nil) || !slices.Equal(literals, test.literals) || fold != test.fold {
+				t.Fatalf("\nActual:\n%q, %v\nExpected:\n%q, %v", literals, fold, test.literals, test.fold)
+			}
+		})
+	}
+}
+
+func TestSearchReaderPrefilter(t *testing.T) {
+	// The input spans several buffers, so that the skipped lines cross their boundaries.
+	var data strings.Builder
+	for i := 0; data.Len() < 3*readerSize; i++ {
+		fmt.Fprintf(&data, "%d GET /index.html 200 client=10.0.0.%d agent=curl\r\n", i, i%256)
+		switch i % 50 {
+		case 0:
+			data.WriteString("ERROR: read timeout\n")
+		case 10:
+			data.WriteString("error: Timeout\n" + "INFO: timeout\n")
+		case 20:
+			data.WriteString("WARN: disk full\n" + "ERROR timeouts: 3\n")
+		case 30:
+			data.WriteString("\xff\xfe timeout\n" + strings.Repeat("x", 100) + " ERROR timeout\n")
+		}
+	}
+
+	tests := []struct {
+		search  []string
+		options func(s *Search) error
+	}{
+		{
+			search:  []string{"ERROR.*timeout"},
+			options: func(s *Search) error { return nil },
+		},
+		{
+			search:  []string{"error.*timeout"},
+			options: func(s *Search) error { return s.IgnoreCase() },
+		},
+		{
+			search:  []string{"timeout", "disk|cpu"},
+			options: func(s *Search) error { return s.MatchWord() },
+		},
+		{
+			search: []string{"(?:INFO|WARN): [a-z]+"},
+			options: func(s *Search) error {
+				s.EnableOnlyMatchingOutput()
+				return s.MatchLine()
+			},
+		},
+		{
+			search: []string{"ERROR"},
+			options: func(s *Search) error {
+				s.Invert()
+				s.AddContext(1, 1)
+				return nil
+			},
+		},
+		{
+			search:  []string{". timeout"},
+			options: func(s *Search) error { return nil },
+		},
+		{
+			search: []string{"ERROR.*timeout"},
+			options: func(s *Search) error {
+				s.EnableStringNumberOutput()
+				s.SetMaxCount(30)
+				return nil
+			},
+		},
+		{
+			search: []string{"ERROR.*timeout"},
+			options: func(s *Search) error {
+				s.SetMaxLineLength(80, TruncateLongLines)
+				s.EnableCountOutput()
+				return nil
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			s, err := New(test.search...)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := test.options(s); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			s.SetBinaryFiles(BinaryFilesText)
+			if s.prefilter == nil {
+				t.Fatalf("The search has no prefilter")
+			}
+
+			var exp, act bytes.Buffer
+			if err := s.SearchReader(strings.NewReader(data.String()), &act); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			actCount := s.GetCountOutput()
+			s.prefilter = nil
+			if err := s.SearchReader(strings.NewReader(data.String()), &exp); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if exp.Len() == 0 && s.GetCountOutput() == 0 {
+				t.Fatalf("The search found nothing")
+			}
+
+			if act.String() != exp.String() {
+				t.Fatalf("\nActual:\n%.300q\nExpected:\n%.300q", act.String(), exp.String())
+			}
+			if actCount != s.GetCountOutput() {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", actCount, s.GetCountOutput())
+			}
+		})
+	}
+}
+
+func TestNewPatternError(t *testing.T) {
+	tests := []string{"(", "a[", "*"}
+
+	for i, search := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			_, err := New("one", search)
+
+			var patternErr *PatternError
+			if !errors.As(err, &patternErr) {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%T", err, patternErr)
+			}
+			if patternErr.Pattern != search {
+				t.Fatalf("\nActual:\n%q\nExpected:\n%q", patternErr.Pattern, search)
+			}
+		})
+	}
+}
+
+func TestSearchReaderIOError(t *testing.T) {
+	errTest := errors.New("test error")
+	tests := []struct {
+		r  io.Reader
+		w  io.Writer
+		op string
+	}{
+		{
+			r:  iotest.ErrReader(errTest),
+			w:  io.Discard,
+			op: "read",
+		},
+		{
+			r:  strings.NewReader("one\n"),
+			w:  errWriter{errTest},
+			op: "write",
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			s, err := New("o")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			err = s.SearchReader(test.r, test.w)
+
+			var ioErr *IOError
+			if !errors.As(err, &ioErr) {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%T", err, ioErr)
+			}
+			if ioErr.Op != test.op || !errors.Is(err, errTest) {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v error: %v", err, test.op, errTest)
+			}
+		})
+	}
+}
+
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write(_ []byte) (int, error) {
+	return 0, w.err
+}
+
 func createFile(t *testing.T, data []byte) *os.File {
 	file, err := os.CreateTemp("", "test*.txt")
 	if err != nil {
@@ -0,0 +1,121 @@
+package searchutil
+
+import (
+	"slices"
+	"unicode"
+	"unicode/utf8"
+)
+
+// isWordChar reports whether r is a word constituent: a letter, a digit or an underscore.
+func isWordChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// acceptWord reports whether text[start:end] is preceded and followed
+// by a non-word character or the edge of the line.
+func acceptWord(text string, start, end int) bool {
+	return isWordStart(text, start) && isWordEnd(text, end)
+}
+
+// isWordStart reports whether no word character precedes position i.
+func isWordStart(text string, i int) bool {
+	r, size := utf8.DecodeLastRuneInString(text[:i])
+	return size == 0 || !isWordChar(r)
+}
+
+// isWordEnd reports whether no word character follows position i.
+func isWordEnd(text string, i int) bool {
+	r, size := utf8.DecodeRuneInString(text[i:])
+	return size == 0 || !isWordChar(r)
+}
+
+// acceptLine reports whether text[start:end] is the whole line.
+func acceptLine(text string, start, end int) bool {
+	return start == 0 && end == len(text)
+}
+
+func (s *Search) matchWordRegexp(text string) bool {
+	if s.prefilter != nil && !s.prefilter.mayMatch(text) {
+		return false
+	}
+	return len(s.findWordsRegexp(text, 1)) > 0
+}
+
+func (s *Search) findAllWordRegexp(text string) [][]int {
+	if s.prefilter != nil && !s.prefilter.mayMatch(text) {
+		return nil
+	}
+	spans := s.findWordsRegexp(text, -1)
+	return slices.DeleteFunc(spans, func(span []int) bool {
+		return span[0] == span[1]
+	})
+}
+
+// findWordsRegexp returns up to n matches that form whole words, or all of them if n < 0.
+// As in GNU grep, if a match is not a whole word, shorter matches at the same position
+// are tried, and then the search goes on from the next character.
+func (s *Search) findWordsRegexp(text string, n int) [][]int {
+	var spans [][]int
+	for start := 0; start <= len(text) && (n < 0 || len(spans) < n); {
+		begin, end, ok := s.nextRegexp(text, start)
+		if !ok {
+			break
+		}
+		if end, ok := s.wordEnd(text, begin, end); ok {
+			spans = append(spans, []int{begin, end})
+			start = max(end, begin+1)
+			continue
+		}
+		if begin == len(text) {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(text[begin:])
+		start = begin + size
+	}
+	return spans
+}
+
+// wordEnd returns the end of the longest match starting at begin
+// that is a whole word, given the longest match ends at end.
+func (s *Search) wordEnd(text string, begin, end int) (int, bool) {
+	if !isWordStart(text, begin) {
+		return 0, false
+	}
+	if isWordEnd(text, end) {
+		return end, true
+	}
+	for e := end - 1; e > begin; e-- {
+		if utf8.RuneStart(text[e]) && isWordEnd(text, e) && s.matchWhole(text, begin, e) {
+			return e, true
+		}
+	}
+	return 0, false
+}
+
+// nextRegexp returns the leftmost match that starts at or after start. The text is not cut
+// at start, so that ^ does not match there and \b sees the character before it.
+func (s *Search) nextRegexp(text string, start int) (begin, end int, ok bool) {
+	if start == 0 {
+		loc := s.re.FindStringIndex(text)
+		if loc == nil {
+			return 0, 0, false
+		}
+		return loc[0], loc[1], true
+	}
+	_, size := utf8.DecodeLastRuneInString(text[:start])
+	loc := s.reNext.FindStringSubmatchIndex(text[start-size:])
+	if loc == nil {
+		return 0, 0, false
+	}
+	return start - size + loc[2], start - size + loc[3], true
+}
+
+// matchWhole reports whether the regexp matches exactly text[begin:end].
+// As in GNU grep, the text is cut at end, but not at begin.
+func (s *Search) matchWhole(text string, begin, end int) bool {
+	if begin == 0 {
+		return s.reWhole.MatchString(text[:end])
+	}
+	_, size := utf8.DecodeLastRuneInString(text[:begin])
+	return s.reWholeAfter.MatchString(text[begin-size : end])
+}
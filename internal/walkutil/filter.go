@@ -0,0 +1,112 @@
+// Package walkutil provides helpers for choosing the files to search in a directory tree.
+package walkutil
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Filter selects files and directories by glob patterns, as the --include,
+// --exclude and --exclude-dir flags of GNU grep do.
+//
+// The patterns have the syntax of path.Match, and a "**" element matches
+// any number of directories. A pattern matches a path if it matches the path
+// or any of its suffixes that start after a separator, so "*.go" matches
+// "src/main.go", and "gen/**" matches everything under any gen directory.
+// The zero value selects everything.
+type Filter struct {
+	include    []string
+	exclude    []string
+	excludeDir []string
+}
+
+// AddInclude makes the filter select only the files matching one of the include patterns.
+// It returns path.ErrBadPattern if the pattern is malformed.
+func (f *Filter) AddInclude(pattern string) error {
+	return addPattern(&f.include, pattern)
+}
+
+// AddExclude makes the filter skip the files matching the pattern, even if they are included.
+// It returns path.ErrBadPattern if the pattern is malformed.
+func (f *Filter) AddExclude(pattern string) error {
+	return addPattern(&f.exclude, pattern)
+}
+
+// AddExcludeDir makes the filter skip the directories matching the pattern.
+// It returns path.ErrBadPattern if the pattern is malformed.
+func (f *Filter) AddExcludeDir(pattern string) error {
+	return addPattern(&f.excludeDir, pattern)
+}
+
+func addPattern(patterns *[]string, pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	*patterns = append(*patterns, pattern)
+	return nil
+}
+
+// File reports whether the file at the path is selected.
+func (f *Filter) File(name string) bool {
+	name = filepath.ToSlash(name)
+	if matchAny(f.exclude, name) {
+		return false
+	}
+	return len(f.include) == 0 || matchAny(f.include, name)
+}
+
+// Dir reports whether the directory at the path is selected, i.e. is to be walked.
+func (f *Filter) Dir(name string) bool {
+	return !matchAny(f.excludeDir, filepath.ToSlash(name))
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the slash-separated name or any of its suffixes
+// that start after a slash matches the pattern. A "**" element of the pattern
+// matches any number of elements of the name, including none.
+// A malformed pattern matches nothing.
+func Match(pattern, name string) bool {
+	patternElems := strings.Split(pattern, "/")
+	name = strings.TrimSuffix(name, "/")
+	for {
+		if matchElems(patternElems, strings.Split(name, "/")) {
+			return true
+		}
+		i := strings.IndexByte(name, '/')
+		if i < 0 {
+			return false
+		}
+		name = name[i+1:]
+	}
+}
+
+// matchElems matches the path elements of a name against the elements of a pattern.
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,79 @@
+package walkutil
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		exp     bool
+	}{
+		{pattern: "*.go", name: "main.go", exp: true},
+		{pattern: "*.go", name: "src/main.go", exp: true},
+		{pattern: "*.go", name: "main.go/x", exp: false},
+		{pattern: "src/*.go", name: "./src/main.go", exp: true},
+		{pattern: "src/*.go", name: "src/a/main.go", exp: false},
+		{pattern: "src/**/*.go", name: "src/a/b/main.go", exp: true},
+		{pattern: "src/**/*.go", name: "src/main.go", exp: true},
+		{pattern: "**/gen/**", name: "/repo/src/gen/a/b.go", exp: true},
+		{pattern: "vendor", name: "/repo/vendor", exp: true},
+		{pattern: "vendor", name: "/repo/vendor2", exp: false},
+		{pattern: "ven[a-z]or", name: "repo/vendor/", exp: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			act := Match(test.pattern, test.name)
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var f Filter
+	if err := f.AddInclude("*.go"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.AddInclude("*.md"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.AddExclude("*_test.go"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.AddExcludeDir("node_modules"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.AddExclude("[a-"); err == nil {
+		t.Fatalf("Expected an error for a malformed pattern")
+	}
+
+	tests := []struct {
+		name string
+		dir  bool
+		exp  bool
+	}{
+		{name: "main.go", exp: true},
+		{name: "docs/readme.md", exp: true},
+		{name: "main_test.go", exp: false},
+		{name: "go.mod", exp: false},
+		{name: "web/node_modules", dir: true, exp: false},
+		{name: "web/src", dir: true, exp: true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			act := f.File(test.name)
+			if test.dir {
+				act = f.Dir(test.name)
+			}
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", act, test.exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package walkutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFiles are the files Ignore reads in each directory. The rules of
+// the later files take precedence, so .ignore can override .gitignore.
+var IgnoreFiles = []string{".gitignore", ".ignore"}
+
+// Ignore holds the rules of the ignore files met while walking a directory tree.
+// The rules have the syntax of .gitignore: "#" starts a comment, "!" negates a rule,
+// a trailing "/" matches only directories, and a pattern with a "/" at the start
+// or in the middle is anchored to the directory of its file; otherwise it matches
+// a name at any depth. The rules of a nested directory take precedence.
+type Ignore struct {
+	root  string
+	rules map[string][]ignoreRule
+}
+
+type ignoreRule struct {
+	// elems are the elements of the pattern relative to the directory of the rule.
+	elems   []string
+	negate  bool
+	dirOnly bool
+}
+
+// NewIgnore returns the rules of a walk of the directory tree rooted at root.
+// The ignore files are read by Load as the walk enters each directory.
+func NewIgnore(root string) *Ignore {
+	return &Ignore{
+		root:  filepath.Clean(root),
+		rules: map[string][]ignoreRule{},
+	}
+}
+
+// Load reads the ignore files of the directory, if it has any.
+func (ig *Ignore) Load(dir string) error {
+	dir = filepath.Clean(dir)
+	var rules []ignoreRule
+	for _, name := range IgnoreFiles {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rules = append(rules, parseIgnore(data)...)
+	}
+	if len(rules) > 0 {
+		ig.rules[dir] = rules
+	}
+	return nil
+}
+
+// Ignored reports whether the file or directory at the path, found in the walk,
+// is ignored by the rules loaded for its parent directories.
+func (ig *Ignore) Ignored(path string, isDir bool) bool {
+	path = filepath.Clean(path)
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if rules, ok := ig.rules[dir]; ok {
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				if matched, ignored := matchIgnore(rules, filepath.ToSlash(rel), isDir); matched {
+					return ignored
+				}
+			}
+		}
+		if dir == ig.root || dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
+
+// matchIgnore finds the last of the rules matching the slash-separated path
+// relative to their directory, and reports whether it ignores the path.
+func matchIgnore(rules []ignoreRule, rel string, isDir bool) (matched, ignored bool) {
+	elems := strings.Split(rel, "/")
+	for i := len(rules) - 1; i >= 0; i-- {
+		rule := rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchElems(rule.elems, elems) {
+			return true, !rule.negate
+		}
+	}
+	return false, false
+}
+
+// parseIgnore parses the rules of an ignore file.
+func parseIgnore(data []byte) []ignoreRule {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := trimTrailingSpaces(strings.TrimSuffix(scanner.Text(), "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		rule.elems = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// trimTrailingSpaces removes the trailing spaces of a line, except one escaped with a backslash.
+func trimTrailingSpaces(line string) string {
+	trimmed := strings.TrimRight(line, " ")
+	if len(trimmed) < len(line) && strings.HasSuffix(trimmed, "\\") {
+		return trimmed + " "
+	}
+	return trimmed
+}
+
+// IsHidden reports whether the name of a file or directory starts with a dot.
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
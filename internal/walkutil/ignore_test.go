@@ -0,0 +1,90 @@
+package walkutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnore(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":          "# build output\n" + "build/\n" + "*.log\n" + "!keep.log\n" + "/top.txt\n" + "docs/*.html\n" + "trailing\\ \n",
+		"sub/.gitignore":      "!*.log\n" + "local.txt\n",
+		"sub/deep/.ignore":    "*.md\n",
+		"sub/deep/.gitignore": "readme.md\n" + "!*.md\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write to file: %v", err)
+		}
+	}
+
+	ig := NewIgnore(root)
+	for _, dir := range []string{"", "sub", "sub/deep"} {
+		if err := ig.Load(filepath.Join(root, dir)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		isDir bool
+		exp   bool
+	}{
+		{name: "build", isDir: true, exp: true},
+		{name: "src/build", isDir: true, exp: true},
+		{name: "build", isDir: false, exp: false},
+		{name: "a.log", exp: true},
+		{name: "src/a.log", exp: true},
+		{name: "keep.log", exp: false},
+		{name: "top.txt", exp: true},
+		{name: "src/top.txt", exp: false},
+		{name: "docs/index.html", exp: true},
+		{name: "docs/api/index.html", exp: false},
+		{name: "trailing ", exp: true},
+		{name: "trailing", exp: false},
+		{name: "sub/a.log", exp: false},
+		{name: "sub/local.txt", exp: true},
+		{name: "local.txt", exp: false},
+		{name: "sub/deep/readme.md", exp: true},
+		{name: "sub/deep/a.log", exp: false},
+		{name: "main.go", exp: false},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			act := ig.Ignored(filepath.Join(root, test.name), test.isDir)
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", act, test.exp)
+			}
+		})
+	}
+}
+
+func TestIsHidden(t *testing.T) {
+	tests := []struct {
+		name string
+		exp  bool
+	}{
+		{name: ".git", exp: true},
+		{name: ".env", exp: true},
+		{name: "main.go", exp: false},
+		{name: ".", exp: false},
+		{name: "..", exp: false},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Case: %v\n", i), func(t *testing.T) {
+			act := IsHidden(test.name)
+			if act != test.exp {
+				t.Fatalf("\nActual:\n%v\nExpected:\n%v", act, test.exp)
+			}
+		})
+	}
+}
@@ -1,75 +1,735 @@
 // A simple grep-like utility written in Go.
-// Searches for a string in files or standard input.
+// Searches for a string in files, directories or standard input.
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/lastlife77/Grep-Utility/internal/archiveutil"
 	"github.com/lastlife77/Grep-Utility/internal/searchutil"
+	"github.com/lastlife77/Grep-Utility/internal/walkutil"
 )
 
 func main() {
 	log.SetFlags(0)
 
-	var file *os.File
-
 	a := flag.Int("A", 0, "After each line found, additionally output N lines after it.")
 	b := flag.Int("B", 0, "Output N lines to each found line.")
 	ctx := flag.Int("C", 0, "Output N lines of context around the found string.")
 	c := flag.Bool("c", false, "Output only the number of lines that match the pattern.")
 	n := flag.Bool("n", false, "Output the line number before each found line.")
 	i := flag.Bool("i", false, "Ignore the case.")
-	f := flag.Bool("f", false, "Treat a template as a fixed string rather than a regular expression.")
+	smartCase := flag.Bool("smart-case", false, "Ignore the case if the patterns have no uppercase letters.")
+	f := flag.Bool("F", false, "Treat a template as a fixed string rather than a regular expression.")
+	var exprs, patternFiles stringList
+	flag.Var(&exprs, "e", "Use the pattern for matching; can be repeated to search for any of several patterns.")
+	flag.Var(&patternFiles, "f", "Take patterns from the file, one per line; '-' means the standard input. Can be repeated.")
+	w := flag.Bool("w", false, "Select only the matches that form whole words.")
+	x := flag.Bool("x", false, "Select only the matches that form the whole line.")
 	v := flag.Bool("v", false, "Invert the filter: output lines that do not contain a template.")
+	r := flag.Bool("r", false, "Read all files under each directory, recursively.")
+	var include, exclude, excludeDir stringList
+	flag.Var(&include, "include", "Search only the files matching the glob; ** matches any number of directories. Can be repeated.")
+	flag.Var(&exclude, "exclude", "Skip the files matching the glob. Can be repeated.")
+	flag.Var(&excludeDir, "exclude-dir", "In recursive search, skip the directories matching the glob. Can be repeated.")
+	noIgnore := flag.Bool("no-ignore", false, "In recursive search, do not skip the files matched by .gitignore and .ignore files.")
+	hidden := flag.Bool("hidden", false, "In recursive search, do not skip hidden files and directories.")
+	rr := flag.Bool("R", false, "Like -r, but follow all symbolic links.")
+	hh := flag.Bool("H", false, "Print the file name for each match.")
+	h := flag.Bool("h", false, "Suppress the file name prefix on output.")
+	total := flag.Bool("total", false, "With -c, also output the total number of matching lines in all files.")
+	o := flag.Bool("o", false, "Output only the matched parts of each found line, each on a separate line.")
+	color := flag.String("color", "auto", "Highlight the matches: auto, always or never. Colors are taken from GREP_COLORS.")
+	m := flag.Int("m", -1, "Stop reading a file after N selected lines.")
+	maxLineLength := flag.Int("max-line-length", 0, "Limit the length of lines in bytes; 0 means no limit.")
+	longLines := flag.String("long-lines", "truncate", "What to do with lines over max-line-length: truncate or skip.")
+	binaryFiles := flag.String("binary-files", "binary", "How to search binary files: binary, text or without-match.")
+	text := flag.Bool("a", false, "Search binary files as text; same as --binary-files=text.")
+	noBinary := flag.Bool("I", false, "Skip binary files; same as --binary-files=without-match.")
+	searchZip := flag.Bool("search-zip", false, "Search the decompressed contents of gzip, bzip2 and zlib files.")
+	searchArchives := flag.Bool("search-archives", false, "Search each file inside zip, tar and tar.gz archives.")
+	q := flag.Bool("q", false, "Quiet; do not write anything and exit immediately on the first match.")
+	l := flag.Bool("l", false, "Output only the names of files with a selected line; stop at the first one in each file.")
+	ll := flag.Bool("L", false, "Output only the names of files without selected lines.")
+	var null bool
+	flag.BoolVar(&null, "Z", false, "Output a zero byte instead of the character that follows a file name.")
+	flag.BoolVar(&null, "null", false, "Same as -Z.")
+	jobs := flag.Int("j", runtime.GOMAXPROCS(0), "Search up to N files, or chunks of a single file, in parallel; the output keeps the order of the lines.")
+	ss := flag.Bool("s", false, "Suppress error messages about nonexistent or unreadable files.")
 
 	flag.Parse()
 	if *ctx != 0 && *a != 0 {
-		log.Fatal("The C and A flags do not match.")
+		fatal("The C and A flags do not match.")
 	}
 	if *ctx != 0 && *b != 0 {
-		log.Fatal("The C and B flags do not match.")
+		fatal("The C and B flags do not match.")
 	}
 	if *c && *n {
-		log.Fatal("The c and n flags do not match.")
+		fatal("The c and n flags do not match.")
+	}
+	if *total && !*c {
+		fatal("The total flag requires the c flag.")
+	}
+	if *hh && *h {
+		fatal("The H and h flags do not match.")
+	}
+	if *jobs < 1 {
+		fatal("The j flag must be at least 1.")
+	}
+	if *l && *ll {
+		fatal("The l and L flags do not match.")
+	}
+	var filter walkutil.Filter
+	for _, glob := range include {
+		if err := filter.AddInclude(glob); err != nil {
+			fatal("The include flag has an invalid glob:", glob)
+		}
+	}
+	for _, glob := range exclude {
+		if err := filter.AddExclude(glob); err != nil {
+			fatal("The exclude flag has an invalid glob:", glob)
+		}
+	}
+	for _, glob := range excludeDir {
+		if err := filter.AddExcludeDir(glob); err != nil {
+			fatal("The exclude-dir flag has an invalid glob:", glob)
+		}
 	}
 	args := flag.Args()
-	search := args[0]
+	patterns := []string(exprs)
+	for _, path := range patternFiles {
+		filePatterns, err := readPatterns(path)
+		if err != nil {
+			fatal("Pattern file reading error:", err)
+		}
+		patterns = append(patterns, filePatterns...)
+	}
+	if len(exprs) == 0 && len(patternFiles) == 0 {
+		if len(args) == 0 {
+			fatal("Usage: grep [flags] pattern [file...]")
+		}
+		patterns = append(patterns, args[0])
+		args = args[1:]
+	}
+	// As in GNU grep, a pattern containing newlines is a list of patterns.
+	var search []string
+	for _, pattern := range patterns {
+		search = append(search, strings.Split(pattern, "\n")...)
+	}
 
-	if len(args) > 1 {
+	var s *searchutil.Search
+	if *f {
+		s = searchutil.NewFixed(search...)
+	} else {
 		var err error
-		file, err = os.Open(args[1])
+		s, err = searchutil.New(search...)
 		if err != nil {
-			log.Fatal("File opening error:", err)
+			fatal(err)
 		}
-	} else {
-		file = os.Stdin
 	}
 
-	s := searchutil.New(search)
-
-	if *ctx != 0 {
+	// As in GNU grep, -c counts only the selected lines, so context is not searched for.
+	if *ctx != 0 && !*c {
 		s.AddContext(*ctx, *ctx)
 	}
-	if *a != 0 || *b != 0 {
-		s.AddContext(*a, *b)
+	if (*a != 0 || *b != 0) && !*c {
+		s.AddContext(*b, *a)
 	}
-	if *c {
+	listFiles := *l || *ll
+	if *c && !listFiles {
 		s.EnableCountOutput()
 	}
 	if *n {
 		s.EnableStringNumberOutput()
 	}
 	if *i {
-		s.IgnoreCase()
+		if err := s.IgnoreCase(); err != nil {
+			fatal(err)
+		}
+	} else if *smartCase {
+		if err := s.SmartCase(); err != nil {
+			fatal(err)
+		}
 	}
-	if *f {
-		s.MatchFixString()
+	if *w {
+		if err := s.MatchWord(); err != nil {
+			fatal(err)
+		}
+	}
+	if *x {
+		if err := s.MatchLine(); err != nil {
+			fatal(err)
+		}
 	}
 	if *v {
 		s.Invert()
 	}
+	if *o && !*c {
+		s.EnableOnlyMatchingOutput()
+	}
+	switch {
+	case *q:
+		s.EnableQuietOutput()
+	case *l:
+		s.EnableFilesWithMatchesOutput()
+	case *ll:
+		s.EnableFilesWithoutMatchOutput()
+	}
+	if null {
+		s.EnableNullAfterFileName()
+	}
+	s.SetMaxCount(*m)
+	if *searchZip {
+		s.EnableDecompression()
+	}
+	if *text {
+		*binaryFiles = "text"
+	}
+	if *noBinary {
+		*binaryFiles = "without-match"
+	}
+	switch *binaryFiles {
+	case "binary":
+		s.SetBinaryFiles(searchutil.BinaryFilesBinary)
+	case "text":
+		s.SetBinaryFiles(searchutil.BinaryFilesText)
+	case "without-match":
+		s.SetBinaryFiles(searchutil.BinaryFilesWithoutMatch)
+	default:
+		fatal("The binary-files flag must be binary, text or without-match.")
+	}
+	switch *longLines {
+	case "truncate":
+		s.SetMaxLineLength(*maxLineLength, searchutil.TruncateLongLines)
+	case "skip":
+		s.SetMaxLineLength(*maxLineLength, searchutil.SkipLongLines)
+	default:
+		fatal("The long-lines flag must be truncate or skip.")
+	}
+	switch *color {
+	case "always":
+		s.EnableColorOutput(os.Getenv("GREP_COLORS"))
+	case "auto":
+		if isTerminal(os.Stdout) {
+			s.EnableColorOutput(os.Getenv("GREP_COLORS"))
+		}
+	case "never":
+	default:
+		fatal("The color flag must be auto, always or never.")
+	}
 
-	s.SearchInFile(file)
+	sr := &searcher{
+		s:            s,
+		withFileName: len(args) > 1 || *r || *rr,
+		recursive:    *r || *rr,
+		followLinks:  *rr,
+		filter:       &filter,
+		noIgnore:     *noIgnore,
+		hidden:       *hidden,
+		archives:     *searchArchives,
+		hideFileName: *h,
+		count:        *c && !*q && !listFiles,
+		null:         null,
+		quiet:        *q,
+		noMessages:   *ss,
+		visited:      map[string]bool{},
+	}
+	if *hh {
+		sr.withFileName = true
+	}
+	if *h {
+		sr.withFileName = false
+	}
+
+	inputs := args
+	if len(inputs) == 0 && sr.recursive {
+		inputs = []string{"."}
+	}
+	// A single file is split into chunks instead, as there is nothing else
+	// to search in parallel. Pipes are not, so that their output streams.
+	if len(inputs) == 1 && !sr.recursive && isRegularFile(inputs[0]) {
+		s.SetParallelism(*jobs)
+	}
+	sr.start(*jobs)
+	if len(inputs) == 0 {
+		sr.searchStdin()
+	}
+	for _, path := range inputs {
+		if sr.done() {
+			break
+		}
+		sr.searchPath(path)
+	}
+	sr.wait()
+	if *total && sr.count {
+		fmt.Printf("total:%v\n", sr.total)
+	}
+
+	switch {
+	case sr.failed && !(sr.quiet && sr.matched):
+		os.Exit(exitError)
+	case !sr.matched:
+		os.Exit(exitNoMatch)
+	}
+}
+
+// Exit statuses, as in GNU grep.
+const (
+	exitNoMatch = 1
+	exitError   = 2
+)
+
+// stringList is a flag that can be repeated, collecting all its values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// readPatterns reads the patterns from a file, one per line.
+// The path "-" means the standard input.
+func readPatterns(path string) ([]string, error) {
+	file := os.Stdin
+	if path != "-" {
+		var err error
+		file, err = os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+	}
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	return patterns, scanner.Err()
+}
+
+// isRegularFile reports whether the path names a regular file.
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// isTerminal reports whether the file is a terminal.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// fatal prints the message and exits with the error status.
+func fatal(v ...any) {
+	log.Println(v...)
+	os.Exit(exitError)
+}
+
+// searcher runs a configured search over the input paths.
+//
+// The paths are walked sequentially, and each file is searched as a task by one
+// of the workers, each with its own copy of the search. The collector writes
+// the output of the tasks in the order they were submitted.
+type searcher struct {
+	s *searchutil.Search
+
+	tasks chan *task
+	// queue holds the tasks in order for the collector. Its capacity bounds
+	// the number of tasks waiting for their output to be written.
+	queue     chan *task
+	workers   sync.WaitGroup
+	collected chan struct{}
+	// stopped is set by the collector when the remaining inputs can be skipped.
+	stopped atomic.Bool
+
+	withFileName bool
+	// hideFileName suppresses the file name even for the files inside archives,
+	// which are otherwise always named as "archive:path".
+	hideFileName bool
+	recursive    bool
+	followLinks  bool
+	archives     bool
+	// filter chooses the files to search, before they are opened.
+	filter *walkutil.Filter
+	// noIgnore disables the ignore files, and hidden searches hidden files,
+	// in the directory trees.
+	noIgnore bool
+	hidden   bool
+
+	// count prints the number of matching lines per input, and total sums them.
+	// null separates the file name from the number with a zero byte.
+	count bool
+	null  bool
+	total int
+
+	// quiet stops the search at the first match, and noMessages suppresses
+	// errors about nonexistent or unreadable files.
+	quiet      bool
+	noMessages bool
+
+	// visited keeps the resolved directories to avoid symlink loops.
+	visited map[string]bool
+
+	// matched and failed are set by the collector, and writeFailed
+	// once a write error is reported, so that it is only reported once.
+	matched     bool
+	failed      bool
+	writeFailed bool
+}
+
+// message is an error to report. file is set for the errors about nonexistent
+// or unreadable inputs, which -s suppresses, and write for the errors writing the output.
+type message struct {
+	v           []any
+	file, write bool
+}
+
+// task is the search of one input. Its output is buffered until the collector
+// reaches it, and then written directly, so that a long search still streams.
+type task struct {
+	run func(t *task)
+	// s is the search of the worker running the task.
+	s *searchutil.Search
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	direct bool
+
+	errs    []message
+	matched bool
+	count   int
+	done    chan struct{}
+}
+
+func (t *task) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.direct {
+		return os.Stdout.Write(p)
+	}
+	return t.buf.Write(p)
+}
+
+// error reports a problem with the input of the task without stopping the search.
+func (t *task) error(v ...any) {
+	t.errs = append(t.errs, message{v: v})
+}
+
+// fileError reports that the input of the task does not exist or cannot be read.
+func (t *task) fileError(v ...any) {
+	t.errs = append(t.errs, message{v: v, file: true})
+}
+
+// writeError reports that the output of the task could not be written.
+func (t *task) writeError(err error) {
+	t.errs = append(t.errs, message{v: []any{err}, write: true})
+}
+
+// start runs the workers and the collector.
+func (sr *searcher) start(jobs int) {
+	sr.tasks = make(chan *task)
+	sr.queue = make(chan *task, 4*jobs)
+	sr.collected = make(chan struct{})
+	for range jobs {
+		sr.workers.Add(1)
+		go sr.work(sr.s.Clone())
+	}
+	go sr.collect()
+}
+
+// wait waits until all the submitted tasks are done and their output is written.
+func (sr *searcher) wait() {
+	close(sr.tasks)
+	close(sr.queue)
+	sr.workers.Wait()
+	<-sr.collected
+}
+
+func (sr *searcher) work(s *searchutil.Search) {
+	defer sr.workers.Done()
+	for t := range sr.tasks {
+		if !sr.done() {
+			t.s = s
+			t.run(t)
+		}
+		close(t.done)
+	}
+}
+
+func (sr *searcher) collect() {
+	defer close(sr.collected)
+	for t := range sr.queue {
+		t.mu.Lock()
+		if _, err := os.Stdout.Write(t.buf.Bytes()); err != nil {
+			sr.report(message{v: []any{"write error:", err}, write: true})
+		}
+		t.direct = true
+		t.mu.Unlock()
+
+		<-t.done
+		for _, m := range t.errs {
+			sr.report(m)
+		}
+		if t.matched {
+			sr.matched = true
+			if sr.quiet {
+				sr.stopped.Store(true)
+			}
+		}
+		sr.total += t.count
+	}
+}
+
+// submit queues the run of a search by one of the workers.
+func (sr *searcher) submit(run func(t *task)) {
+	t := &task{run: run, done: make(chan struct{})}
+	sr.queue <- t
+	sr.tasks <- t
+}
+
+// done reports whether the remaining inputs can be skipped.
+func (sr *searcher) done() bool {
+	return sr.stopped.Load()
+}
+
+// searchStdin searches the standard input.
+func (sr *searcher) searchStdin() {
+	sr.submit(func(t *task) {
+		sr.search(t, os.Stdin, "(standard input)", sr.withFileName)
+	})
+}
+
+// searchPath searches a file or, in recursive mode, a directory tree.
+func (sr *searcher) searchPath(path string) {
+	if path == "-" {
+		sr.searchStdin()
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		sr.fileError("File opening error:", err)
+		return
+	}
+	if info.IsDir() {
+		if sr.recursive {
+			var ig *walkutil.Ignore
+			if !sr.noIgnore {
+				ig = walkutil.NewIgnore(path)
+			}
+			sr.searchDir(path, ig)
+		} else {
+			sr.fileError(path + ": Is a directory")
+		}
+		return
+	}
+	if sr.filter.File(path) {
+		sr.searchFile(path)
+	}
+}
+
+// searchDir walks the directory tree rooted at root and searches every
+// regular file in it that is not skipped. If followLinks is set,
+// symbolic links to files and directories are followed.
+// The ignore files are loaded into ig, unless it is nil.
+func (sr *searcher) searchDir(root string, ig *walkutil.Ignore) {
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		if sr.visited[real] {
+			return
+		}
+		sr.visited[real] = true
+	}
+	// WalkDir does not follow a symbolic link given as the root,
+	// but a trailing separator makes it resolve the link.
+	if info, err := os.Lstat(root); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		root += string(filepath.Separator)
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if sr.done() {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			sr.fileError("File opening error:", err)
+			return nil
+		}
+		if path == root {
+			sr.loadIgnore(path, ig)
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 && sr.followLinks {
+			info, err := os.Stat(path)
+			if err != nil {
+				sr.fileError("File opening error:", err)
+				return nil
+			}
+			if info.IsDir() {
+				if !sr.skipped(path, true, ig) {
+					sr.searchDir(path, ig)
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() && !sr.skipped(path, false, ig) {
+				sr.searchFile(path)
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if sr.skipped(path, true, ig) {
+				return filepath.SkipDir
+			}
+			sr.loadIgnore(path, ig)
+			return nil
+		}
+		if d.Type().IsRegular() && !sr.skipped(path, false, ig) {
+			sr.searchFile(path)
+		}
+		return nil
+	})
+	if err != nil {
+		sr.fileError("File opening error:", err)
+	}
+}
+
+// skipped reports whether the walk skips the file or directory at the path
+// as hidden, ignored by the ignore files, or not chosen by the filter.
+func (sr *searcher) skipped(path string, isDir bool, ig *walkutil.Ignore) bool {
+	if !sr.hidden && walkutil.IsHidden(filepath.Base(path)) {
+		return true
+	}
+	if ig != nil && ig.Ignored(path, isDir) {
+		return true
+	}
+	if isDir {
+		return !sr.filter.Dir(path)
+	}
+	return !sr.filter.File(path)
+}
+
+// loadIgnore loads the ignore files of the directory into ig, unless it is nil.
+func (sr *searcher) loadIgnore(dir string, ig *walkutil.Ignore) {
+	if ig == nil {
+		return
+	}
+	if err := ig.Load(dir); err != nil {
+		sr.error("Ignore file reading error:", err)
+	}
+}
+
+// searchFile submits the search of a single file, prefixing output lines
+// with its path if file names are enabled.
+func (sr *searcher) searchFile(path string) {
+	sr.submit(func(t *task) {
+		file, err := os.Open(path)
+		if err != nil {
+			t.fileError("File opening error:", err)
+			return
+		}
+		defer file.Close()
+
+		if sr.archives {
+			ok, err := archiveutil.Walk(file, func(member string, r io.Reader) error {
+				sr.search(t, r, path+":"+member, !sr.hideFileName)
+				if sr.done() {
+					return fs.SkipAll
+				}
+				return nil
+			})
+			if err != nil {
+				t.error("Archive reading error:", path+":", err)
+			}
+			if ok {
+				return
+			}
+		}
+		sr.search(t, file, path, sr.withFileName)
+	})
+}
+
+// search runs the search of the task on an opened input and, in count mode,
+// prints the number of matching lines in it.
+func (sr *searcher) search(t *task, r io.Reader, name string, withFileName bool) {
+	if withFileName {
+		t.s.SetFileName(name)
+	} else {
+		t.s.SetFileName("")
+	}
+	t.s.SetInputName(name)
+	if err := t.s.SearchReader(r, t); err != nil {
+		var ioErr *searchutil.IOError
+		if errors.As(err, &ioErr) && ioErr.Op == "write" {
+			t.writeError(err)
+		} else {
+			t.fileError(err)
+		}
+	}
+	if t.s.Matched() {
+		t.matched = true
+	}
+
+	if sr.count {
+		count := t.s.GetCountOutput()
+		t.count += count
+		if withFileName {
+			sep := ":"
+			if sr.null {
+				sep = "\x00"
+			}
+			fmt.Fprintf(t, "%v%v%v\n", name, sep, count)
+		} else {
+			fmt.Fprintln(t, count)
+		}
+	}
+}
+
+// error reports a problem found while walking the inputs without stopping the search.
+// It is reported in order with the output of the files.
+func (sr *searcher) error(v ...any) {
+	sr.queueError(message{v: v})
+}
+
+// fileError reports that an input does not exist or cannot be read.
+func (sr *searcher) fileError(v ...any) {
+	sr.queueError(message{v: v, file: true})
+}
+
+func (sr *searcher) queueError(m message) {
+	t := &task{errs: []message{m}, done: make(chan struct{})}
+	close(t.done)
+	sr.queue <- t
+}
+
+// report prints an error and marks the search as failed. The errors about inputs
+// are not printed if noMessages is set, and only the first write error is printed.
+// It is only called by the collector.
+func (sr *searcher) report(m message) {
+	sr.failed = true
+	if m.write {
+		if sr.writeFailed {
+			return
+		}
+		sr.writeFailed = true
+	}
+	if m.file && sr.noMessages {
+		return
+	}
+	log.Println(m.v...)
 }
@@ -3,11 +3,17 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"sync"
 	"testing"
+
+	"github.com/lastlife77/Grep-Utility/internal/searchutil"
+	"github.com/lastlife77/Grep-Utility/internal/walkutil"
 )
 
 // BenchmarkConcurrency-12
@@ -44,6 +50,202 @@ func BenchmarkWithoutConcurrency(t *testing.B) {
 	}
 }
 
+// BenchmarkManyFixStrings searches lines for 10000 fixed strings
+// with the Aho-Corasick automaton built by NewFixed.
+// BenchmarkManyFixStrings
+// 1647            623211 ns/op              51 B/op          1 allocs/op
+// PASS
+func BenchmarkManyFixStrings(t *testing.B) {
+	patterns := make([]string, 10000)
+	for i := range patterns {
+		patterns[i] = fmt.Sprintf("ioc-%x-%d", i*7919, i)
+	}
+	var data strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&data, "%d GET /index.html 200 client=10.0.0.%d agent=curl\n", i, i%256)
+	}
+
+	s := searchutil.NewFixed(patterns...)
+	t.ResetTimer()
+	for i := 0; i < t.N; i++ {
+		if err := s.SearchReader(strings.NewReader(data.String()), io.Discard); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
+
+// BenchmarkParallelFiles searches a directory of 200 files
+// with the worker pool of the searcher, instead of a goroutine per line.
+// Measured on a single CPU, so the gain of j=4 comes from overlapping reads.
+// BenchmarkParallelFiles/j=1
+// 31          37688792 ns/op        19488943 B/op     202462 allocs/op
+// BenchmarkParallelFiles/j=4
+// 30          34304759 ns/op        19490357 B/op     202468 allocs/op
+// PASS
+// ok      github.com/lastlife77/Grep-Utility      3.188s
+func BenchmarkParallelFiles(t *testing.B) {
+	dir := t.TempDir()
+	var data strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&data, "%d GET /index.html 200 client=10.0.0.%d agent=curl\n", i, i%256)
+	}
+	for i := 0; i < 200; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.log", i)), []byte(data.String()), 0o644); err != nil {
+			t.Fatalf("Failed to write to file: %v", err)
+		}
+	}
+	s, err := searchutil.New("POST")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, jobs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("j=%d", jobs), func(t *testing.B) {
+			for i := 0; i < t.N; i++ {
+				sr := &searcher{
+					s:         s,
+					recursive: true,
+					filter:    &walkutil.Filter{},
+					visited:   map[string]bool{},
+				}
+				sr.start(jobs)
+				sr.searchPath(dir)
+				sr.wait()
+				if sr.failed || sr.matched {
+					t.Fatalf("Unexpected result: %v, %v", sr.failed, sr.matched)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkChunks searches a single 8 MB input split into chunks, which replaces
+// the goroutine per line of BenchmarkConcurrency. Measured on a single CPU,
+// so j=4 only shows the overhead of the chunks: the matching has to run on
+// several CPUs to pay off.
+// BenchmarkChunks/j=1
+// 36          41729494 ns/op              35 B/op          1 allocs/op
+// BenchmarkChunks/j=4
+// 27          44426921 ns/op        10161546 B/op        192 allocs/op
+// PASS
+func BenchmarkChunks(t *testing.B) {
+	var data strings.Builder
+	for i := 0; data.Len() < 8<<20; i++ {
+		fmt.Fprintf(&data, "%d GET /index.html 200 client=10.0.0.%d agent=curl\n", i, i%256)
+	}
+	s, err := searchutil.New(`client=10\.0\.0\.1[0-9]{2} agent=wget`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, jobs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("j=%d", jobs), func(t *testing.B) {
+			s.SetParallelism(jobs)
+			for i := 0; i < t.N; i++ {
+				if err := s.SearchReader(strings.NewReader(data.String()), io.Discard); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkScanLines searches 10000 lines none of which match,
+// so that allocs/op shows the cost of the scan loop itself.
+// Before the scan loop worked on the read buffer, each line was allocated:
+// BenchmarkScanLines/default       643     1784052 ns/op    672802 B/op    10003 allocs/op
+// BenchmarkScanLines/numbers       495     2474677 ns/op    672802 B/op    10003 allocs/op
+// BenchmarkScanLines/context       235     5142258 ns/op    829460 B/op    29740 allocs/op
+// Now:
+// BenchmarkScanLines/default      1050     1011154 ns/op        31 B/op        0 allocs/op
+// BenchmarkScanLines/numbers      1221      980252 ns/op        27 B/op        0 allocs/op
+// BenchmarkScanLines/context       909     1108907 ns/op        36 B/op        0 allocs/op
+// PASS
+func BenchmarkScanLines(t *testing.B) {
+	var data strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&data, "%d GET /index.html 200 client=10.0.0.%d agent=curl\n", i, i%256)
+	}
+
+	tests := []struct {
+		name    string
+		options func(s *searchutil.Search)
+	}{
+		{name: "default", options: func(s *searchutil.Search) {}},
+		{name: "numbers", options: func(s *searchutil.Search) { s.EnableStringNumberOutput() }},
+		{name: "context", options: func(s *searchutil.Search) {
+			s.AddContext(2, 2)
+			s.EnableStringNumberOutput()
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.B) {
+			s, err := searchutil.New("POST")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			test.options(s)
+			r := strings.NewReader(data.String())
+			t.ReportAllocs()
+			t.ResetTimer()
+			for i := 0; i < t.N; i++ {
+				r.Seek(0, io.SeekStart)
+				if err := s.SearchReader(r, io.Discard); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPrefilter searches a log where 1% of the lines match ERROR.*timeout.
+// The lines before the next "timeout" in the read buffer are skipped,
+// and the regexp only runs on the lines that contain it.
+// Before the literals of the patterns were searched first:
+// BenchmarkPrefilter/default          1239      992156 ns/op      6826 B/op     200 allocs/op
+// BenchmarkPrefilter/ignore-case        60    21114623 ns/op      7350 B/op     200 allocs/op
+// Now:
+// BenchmarkPrefilter/default          3165      317459 ns/op      6810 B/op     200 allocs/op
+// BenchmarkPrefilter/ignore-case       133    10482987 ns/op      7048 B/op     200 allocs/op
+// PASS
+func BenchmarkPrefilter(t *testing.B) {
+	var data strings.Builder
+	for i := 0; i < 10000; i++ {
+		if i%100 == 0 {
+			fmt.Fprintf(&data, "%d ERROR GET /index.html client=10.0.0.%d: read timeout\n", i, i%256)
+		} else {
+			fmt.Fprintf(&data, "%d INFO GET /index.html 200 client=10.0.0.%d agent=curl\n", i, i%256)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		options func(s *searchutil.Search) error
+	}{
+		{name: "default", options: func(s *searchutil.Search) error { return nil }},
+		{name: "ignore-case", options: func(s *searchutil.Search) error { return s.IgnoreCase() }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.B) {
+			s, err := searchutil.New("ERROR.*timeout")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := test.options(s); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			r := strings.NewReader(data.String())
+			t.ResetTimer()
+			for i := 0; i < t.N; i++ {
+				r.Seek(0, io.SeekStart)
+				if err := s.SearchReader(r, io.Discard); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
 func searchInFileConcurrency(search string, file *os.File) {
 	re, err := regexp.Compile(search)
 	if err != nil {
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 )
 
@@ -59,7 +65,7 @@ intense interest and surprise than the rest, and at the mention of the
 wrinkled brow and crooked jaw they had started as if each was separately
 touched by some specific recollection.`)
 	search := "th+"
-	exp := []byte("The C and A flags do not match.\nexit status 1\n")
+	exp := []byte("The C and A flags do not match.\nexit status 2\n")
 
 	if _, err := file.Write(data); err != nil {
 		t.Fatalf("Failed to write to file: %v", err)
@@ -78,3 +84,710 @@ touched by some specific recollection.`)
 		t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, exp)
 	}
 }
+
+func TestRecursive(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	files := map[string]string{
+		"a.txt":                       "one\ntwo\nthree\n",
+		filepath.Join("sub", "b.txt"): "four\nfive\nsix\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write to file: %v", err)
+		}
+	}
+	search := "o"
+	exp := []byte(
+		filepath.Join(dir, "a.txt") + ":one\n" +
+			filepath.Join(dir, "a.txt") + ":two\n" +
+			filepath.Join(dir, "sub", "b.txt") + ":four\n")
+
+	cmd := exec.Command("go", "run", "main.go", "-r", search, dir)
+	act, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err.Error())
+	}
+	if !slices.Equal(act, exp) {
+		t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, exp)
+	}
+}
+
+func TestMultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	if err := os.WriteFile(b, []byte("four\nfive\nsix\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		exp  []byte
+	}{
+		{
+			args: []string{"o", a, b},
+			exp:  []byte(a + ":one\n" + a + ":two\n" + b + ":four\n"),
+		},
+		{
+			args: []string{"-h", "o", a, b},
+			exp:  []byte("one\ntwo\nfour\n"),
+		},
+		{
+			args: []string{"-H", "o", a},
+			exp:  []byte(a + ":one\n" + a + ":two\n"),
+		},
+		{
+			args: []string{"-n", "-B=1", "five", a, b},
+			exp:  []byte(b + "-1- four\n" + b + ":2: five\n"),
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		if !slices.Equal(act, test.exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	if err := os.WriteFile(b, []byte("four\nfive\nsix\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		exp  []byte
+	}{
+		{
+			args: []string{"-c", "o", a},
+			exp:  []byte("2\n"),
+		},
+		{
+			args: []string{"-c", "o", a, b},
+			exp:  []byte(a + ":2\n" + b + ":1\n"),
+		},
+		{
+			args: []string{"-c", "-total", "-h", "o", a, b},
+			exp:  []byte("2\n1\ntotal:3\n"),
+		},
+		{
+			args: []string{"-c", "-A=1", "o", a},
+			exp:  []byte("2\n"),
+		},
+		{
+			args: []string{"-c", "-C=1", "five", b},
+			exp:  []byte("1\n"),
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		if !slices.Equal(act, test.exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(a, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+
+	tests := []struct {
+		args []string
+		exp  []byte
+	}{
+		{
+			args: []string{"o", a},
+			exp:  []byte("one\ntwo\n"),
+		},
+		{
+			args: []string{"four", a},
+			exp:  []byte("exit status 1\n"),
+		},
+		{
+			args: []string{"-q", "o", a},
+			exp:  []byte(""),
+		},
+		{
+			args: []string{"-q", "four", a},
+			exp:  []byte("exit status 1\n"),
+		},
+		{
+			args: []string{"-s", "o", missing},
+			exp:  []byte("exit status 2\n"),
+		},
+		{
+			args: []string{"-q", "-s", "o", missing, a},
+			exp:  []byte(""),
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		act, _ := cmd.CombinedOutput()
+		if !slices.Equal(act, test.exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+		}
+	}
+}
+
+func TestMultiplePatterns(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	patterns := filepath.Join(dir, "patterns.txt")
+	if err := os.WriteFile(a, []byte("one\ntwo\nthree\nfour\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	if err := os.WriteFile(patterns, []byte("thr\nfo\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+
+	tests := []struct {
+		args  []string
+		stdin string
+		exp   []byte
+	}{
+		{
+			args: []string{"-e", "one", "-e", "two", a},
+			exp:  []byte("one\ntwo\n"),
+		},
+		{
+			args: []string{"-f", patterns, a},
+			exp:  []byte("three\nfour\n"),
+		},
+		{
+			args: []string{"-e", "one", "-f", patterns, a},
+			exp:  []byte("one\nthree\nfour\n"),
+		},
+		{
+			args:  []string{"-F", "-f", "-", a},
+			stdin: "o\n",
+			exp:   []byte("one\ntwo\nfour\n"),
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		cmd.Stdin = strings.NewReader(test.stdin)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		if !slices.Equal(act, test.exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+		}
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	if err := os.WriteFile(b, []byte("four\nfive\nsix\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		exp  []byte
+	}{
+		{
+			args: []string{"-l", "o", a, b},
+			exp:  []byte(a + "\n" + b + "\n"),
+		},
+		{
+			args: []string{"-l", "two", a},
+			exp:  []byte(a + "\n"),
+		},
+		{
+			args: []string{"-L", "two", a, b},
+			exp:  []byte(b + "\n"),
+		},
+		{
+			args: []string{"-l", "-Z", "o", a, b},
+			exp:  []byte(a + "\x00" + b + "\x00"),
+		},
+		{
+			args: []string{"--null", "-n", "two", a, b},
+			exp:  []byte(a + "\x002: two\n"),
+		},
+		{
+			args: []string{"-c", "-Z", "two", a, b},
+			exp:  []byte(a + "\x001\n" + b + "\x000\n"),
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		if !slices.Equal(act, test.exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+		}
+	}
+}
+
+func TestBinaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.bin")
+	if err := os.WriteFile(a, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	if err := os.WriteFile(b, []byte("four\x00\nfive\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		exp  []byte
+	}{
+		{
+			args: []string{"f", b},
+			exp:  []byte("Binary file " + b + " matches\n"),
+		},
+		{
+			args: []string{"o", a, b},
+			exp:  []byte(a + ":one\n" + a + ":two\n" + "Binary file " + b + " matches\n"),
+		},
+		{
+			args: []string{"-a", "f", b},
+			exp:  []byte("four\x00\nfive\n"),
+		},
+		{
+			args: []string{"-I", "o", a, b},
+			exp:  []byte(a + ":one\n" + a + ":two\n"),
+		},
+		{
+			args: []string{"--binary-files=without-match", "-L", "o", a, b},
+			exp:  []byte(b + "\n"),
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		if !slices.Equal(act, test.exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+		}
+	}
+}
+
+func TestSearchZip(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.log.gz")
+	if err := os.WriteFile(a, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("four\nfive\nsix\n"))
+	w.Close()
+	if err := os.WriteFile(b, gz.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		exp  []byte
+	}{
+		{
+			args: []string{"--search-zip", "-n", "-B=1", "i", a, b},
+			exp:  []byte(b + "-1- four\n" + b + ":2: five\n" + b + ":3: six\n"),
+		},
+		{
+			args: []string{"--search-zip", "-c", "t", a, b},
+			exp:  []byte(a + ":2\n" + b + ":0\n"),
+		},
+		{
+			args: []string{"--search-zip", "-l", "five", a, b},
+			exp:  []byte(b + "\n"),
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		if !slices.Equal(act, test.exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+		}
+	}
+}
+
+func TestSearchArchives(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.tar.gz")
+	if err := os.WriteFile(a, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range []string{"conf/app.conf", "conf/db.conf"} {
+		data := []byte("name=" + name + "\nport=80\n")
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(data))})
+		tw.Write(data)
+	}
+	tw.Close()
+	gw.Close()
+	if err := os.WriteFile(b, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		exp  []byte
+	}{
+		{
+			args: []string{"--search-archives", "-n", "db", b},
+			exp:  []byte(b + ":conf/db.conf:1: name=conf/db.conf\n"),
+		},
+		{
+			args: []string{"--search-archives", "-c", "port", a, b},
+			exp:  []byte(a + ":0\n" + b + ":conf/app.conf:1\n" + b + ":conf/db.conf:1\n"),
+		},
+		{
+			args: []string{"--search-archives", "-h", "port", b},
+			exp:  []byte("port=80\nport=80\n"),
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		if !slices.Equal(act, test.exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, test.exp)
+		}
+	}
+}
+
+func TestIncludeExclude(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "src/b.go", "src/b_test.go", "src/gen/c.go", "vendor/d.go", "e.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("one\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write to file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		exp  []string
+	}{
+		{
+			args: []string{"--include=*.go", "--exclude-dir=vendor", "--exclude=*_test.go"},
+			exp:  []string{"a.go", "src/b.go", "src/gen/c.go"},
+		},
+		{
+			args: []string{"--include=src/**", "--exclude-dir=gen"},
+			exp:  []string{"src/b.go", "src/b_test.go"},
+		},
+		{
+			args: []string{"--exclude=*.go"},
+			exp:  []string{"e.txt"},
+		},
+	}
+
+	for _, test := range tests {
+		args := append([]string{"run", "main.go", "-r", "-l"}, test.args...)
+		cmd := exec.Command("go", append(args, "one", dir)...)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		var exp []byte
+		for _, name := range test.exp {
+			exp = append(exp, filepath.Join(dir, name)+"\n"...)
+		}
+		if !slices.Equal(act, exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, exp)
+		}
+	}
+}
+
+func TestIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":    "build/\n*.log\n!keep.log\n",
+		".hidden/a.txt": "one\n",
+		".env":          "one\n",
+		"a.txt":         "one\n",
+		"build/b.txt":   "one\n",
+		"c.log":         "one\n",
+		"keep.log":      "one\n",
+		"sub/.ignore":   "d.txt\n",
+		"sub/d.txt":     "one\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write to file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		exp  []string
+	}{
+		{
+			args: []string{},
+			exp:  []string{"a.txt", "keep.log"},
+		},
+		{
+			args: []string{"--hidden"},
+			exp:  []string{".env", ".hidden/a.txt", "a.txt", "keep.log"},
+		},
+		{
+			args: []string{"--no-ignore"},
+			exp:  []string{"a.txt", "build/b.txt", "c.log", "keep.log", "sub/d.txt"},
+		},
+	}
+
+	for _, test := range tests {
+		args := append([]string{"run", "main.go", "-r", "-l"}, test.args...)
+		cmd := exec.Command("go", append(args, "one", dir)...)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		var exp []byte
+		for _, name := range test.exp {
+			exp = append(exp, filepath.Join(dir, name)+"\n"...)
+		}
+		if !slices.Equal(act, exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, exp)
+		}
+	}
+}
+
+func TestParallel(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		data := strings.Repeat(fmt.Sprintf("line %d\n", i), i*100)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.txt", i)), []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write to file: %v", err)
+		}
+	}
+
+	var exp []byte
+	for _, jobs := range []string{"1", "8"} {
+		cmd := exec.Command("go", "run", "main.go", "-r", "-c", "--total", "-j", jobs, "line [0-9]*0$", dir)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		if exp == nil {
+			exp = act
+			continue
+		}
+		if !slices.Equal(act, exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, exp)
+		}
+	}
+	if !bytes.HasSuffix(exp, []byte("total:10000\n")) {
+		t.Fatalf("Unexpected output: %q", exp)
+	}
+}
+
+func TestParallelChunks(t *testing.T) {
+	a := filepath.Join(t.TempDir(), "a.log")
+	var data strings.Builder
+	for i := 0; data.Len() < 3<<20; i++ {
+		fmt.Fprintf(&data, "%d client=%d\n", i, i%1000)
+	}
+	if err := os.WriteFile(a, []byte(data.String()), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+
+	var exp []byte
+	for _, jobs := range []string{"1", "4"} {
+		cmd := exec.Command("go", "run", "main.go", "-n", "-C", "2", "-j", jobs, "client=999$", a)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err.Error())
+		}
+		if exp == nil {
+			exp = act
+			continue
+		}
+		if !slices.Equal(act, exp) {
+			t.Fatalf("\nActual:\n%.300q\nExpected:\n%.300q", act, exp)
+		}
+	}
+	if !bytes.HasPrefix(exp, []byte("998- 997 client=997\n999- 998 client=998\n1000: 999 client=999\n")) {
+		t.Fatalf("Unexpected output: %.300q", exp)
+	}
+}
+
+func TestParallelChunksArchive(t *testing.T) {
+	// The members span several chunks, and the search of each one stops early,
+	// so the next member must not be read until the chunks of the last one are.
+	a := filepath.Join(t.TempDir(), "a.tar")
+	var data strings.Builder
+	data.WriteString("match\n")
+	for i := 0; data.Len() < 8<<20; i++ {
+		fmt.Fprintf(&data, "%d client=%d\n", i, i%1000)
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	var names []string
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("%d.log", i)
+		names = append(names, name)
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(data.Len())})
+		tw.Write([]byte(data.String()))
+	}
+	tw.Close()
+	if err := os.WriteFile(a, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		line string
+	}{
+		{
+			args: []string{"-j", "2", "--search-archives", "-l", "match", a},
+			line: "",
+		},
+		{
+			args: []string{"-j", "2", "--search-archives", "-m", "1", "match", a},
+			line: ":match",
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		act, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\n%s", err.Error(), act)
+		}
+		var exp []byte
+		for _, name := range names {
+			exp = append(exp, a+":"+name+test.line+"\n"...)
+		}
+		if !slices.Equal(act, exp) {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, exp)
+		}
+	}
+}
+
+func TestNoMessages(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.tar")
+	if err := os.WriteFile(a, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	// The output of a large file is written directly once the collector reaches it,
+	// so that writing fails both in the collector and in the search.
+	c := filepath.Join(dir, "c.txt")
+	if err := os.WriteFile(c, bytes.Repeat([]byte("one\n"), 1<<20), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	// A member followed by a block that is not a valid tar header.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "c.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4})
+	tw.Write([]byte("one\n"))
+	tw.Flush()
+	buf.Write(bytes.Repeat([]byte("x"), 512))
+	if err := os.WriteFile(b, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed to write to file: %v", err)
+	}
+	full, err := os.OpenFile("/dev/full", os.O_WRONLY, 0)
+	if err != nil {
+		t.Skipf("No /dev/full: %v", err)
+	}
+	defer full.Close()
+
+	tests := []struct {
+		args   []string
+		stdout *os.File
+		exp    []string
+	}{
+		{
+			args: []string{"-s", "o", filepath.Join(dir, "missing.txt"), a},
+			exp:  []string{a + ":one", a + ":two"},
+		},
+		{
+			args:   []string{"-s", "o", a},
+			stdout: full,
+			exp:    []string{"write error: write /dev/stdout: no space left on device"},
+		},
+		{
+			args:   []string{"o", c},
+			stdout: full,
+			exp:    []string{"write error: write /dev/stdout: no space left on device"},
+		},
+		{
+			args: []string{"-s", "--search-archives", "one", b},
+			exp:  []string{b + ":c.txt:one", "Archive reading error: " + b + ": archive/tar: invalid tar header"},
+		},
+	}
+
+	for _, test := range tests {
+		cmd := exec.Command("go", append([]string{"run", "main.go"}, test.args...)...)
+		var out bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &out, &out
+		if test.stdout != nil {
+			cmd.Stdout = test.stdout
+		}
+		if err := cmd.Run(); err == nil || err.Error() != "exit status 1" {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// go run reports the exit status 2 of the program and exits with 1.
+		act := out.String()
+		exp := strings.Join(test.exp, "\n") + "\nexit status 2\n"
+		if act != exp {
+			t.Fatalf("\nActual:\n%q\nExpected:\n%q", act, exp)
+		}
+	}
+}